@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"sync"
@@ -17,6 +18,9 @@ import (
 var (
 	_asyncers sync.Map
 
+	// 每次获取异步配置的默认超时时间
+	_defaultFetchTimeout = 5 * time.Second
+
 	// for mock
 	_now = time.Now
 )
@@ -25,6 +29,12 @@ type AsyncerArgs struct {
 	Ins          Asyncer
 	CacheTime    time.Duration
 	RefreshAsync bool
+
+	// Required 通过Load创建的配置是否必须加载成功，见WithRequired
+	Required bool
+
+	// TrustedKeys 通过Load创建的配置需校验签名，见WithTrustedKeys
+	TrustedKeys TrustedKeys
 }
 
 func RegisterAsyner(typeName string, args *AsyncerArgs) {
@@ -52,13 +62,39 @@ type AsyncConfig struct {
 	ConfigHelper
 }
 
+// Close 停止配置刷新及监听，移除所有监听者，之后的Set返回ErrClosed
+// Get继续返回关闭前的配置值
+func (c *AsyncConfig) Close() error {
+	return c.Configer.(*asyncConfig).Close()
+}
+
+func (c *AsyncConfig) hasReferences() bool {
+	return c.Configer.(*asyncConfig).hasReferences()
+}
+
+func (c *AsyncConfig) isLocal() bool {
+	return c.Configer.(*asyncConfig).isLocal()
+}
+
 // NewAsyncConfig 异步配置（qconf/consul/rds...）
 //
 // asyncer: 实现异步获取及设置接口的对象
 // asyncKey: 获取整个异步的Key（和Get方法的Key要区分）
 // cacheTime: 配置缓存的时间，超过该缓存时间会触发重新获取异步数据. <= 0 数据不过期
 // refreshAsync: 缓存过期时，刷新数据是同步还是异步（同步：有查询请求时，会等待数据刷新完成，异步则不会等待）
-func NewAsyncConfig(asyncer Asyncer, asyncKey string, cacheTime time.Duration, refreshAsync bool) *AsyncConfig {
+// opts: 可选配置，如WithRequired
+func NewAsyncConfig(asyncer Asyncer, asyncKey string, cacheTime time.Duration, refreshAsync bool, opts ...AsyncOption) *AsyncConfig {
+	// 本地文件经装饰器（如CachedAsyncer）包装后仍是本地配置
+	if _, ok := baseAsyncer(asyncer).(*FileAsyncer); ok {
+		opts = append([]AsyncOption{WithLocalTags(true)}, opts...)
+	}
+
+	return NewAsyncConfigV2(AdaptAsyncer(asyncer), asyncKey, cacheTime, refreshAsync, opts...)
+}
+
+// NewAsyncConfigV2 同NewAsyncConfig，使用AsyncerV2获取配置
+// 获取配置的错误、版本会记录在Status中，每次获取的超时时间见WithFetchTimeout
+func NewAsyncConfigV2(asyncer AsyncerV2, asyncKey string, cacheTime time.Duration, refreshAsync bool, opts ...AsyncOption) *AsyncConfig {
 	contentType := asyncer.ContentType(asyncKey)
 
 	cfg := &asyncConfig{
@@ -68,17 +104,32 @@ func NewAsyncConfig(asyncer Asyncer, asyncKey string, cacheTime time.Duration, r
 		asyncer:      asyncer,
 		cacheTime:    cacheTime,
 		refreshAsync: refreshAsync,
+		fetchTimeout: _defaultFetchTimeout,
 		quit:         make(chan struct{}),
+		ready:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
 	}
 
 	cfg.refresh()
 
-	if notify := asyncer.Watch(asyncKey); notify != nil {
+	if !cfg.isReady() {
+		// 首次加载失败，后台重试直到加载成功
+		go cfg.retryLoad(_loadRetryInterval)
+	}
+
+	if cfg.watchKey(asyncKey, false) {
 		// 推送更新机制下可以不使用过期策略
 		// 但为了防止更新消息丢失导致的旧值一直得不到更新
 		// 设置一个兜底的过期时间
 		cfg.cacheTime = 5 * time.Minute
-		go cfg.watch(notify)
+	}
+
+	// 签名晚于内容写入时，签名的变化同样需要触发重新加载
+	if len(cfg.trustedKeys) > 0 {
+		cfg.watchKey(asyncKey+SignatureSuffix, false)
 	}
 
 	return &AsyncConfig{
@@ -95,35 +146,101 @@ type asyncConfig struct {
 	contentType   ContentType
 	value         atomic.Value
 	rawMessageMd5 string
+	attrsGen      uint64 // 解析条件值时的实例属性版本
 
 	sf singleflight.Group
 
-	notifiers []chan struct{}
+	watchers watchers
 
-	asyncer      Asyncer
+	asyncer      AsyncerV2
+	version      Version
+	fetchTimeout time.Duration
 	refreshAsync bool
 	refreshTime  int64
 	cacheTime    time.Duration
 	quit         chan struct{}
+	closed       int32
+
+	// 加载状态
+	required  bool
+	ready     chan struct{}
+	readyOnce sync.Once
+	statusMu  sync.RWMutex
+	loadTime  time.Time
+	lastErr   error
+	errTime   time.Time
+
+	// 配置校验
+	validators  []Validator
+	rejected    *RejectEvent
+	rejectedMd5 string
+
+	// 被引用的配置（见IncludeKey）的版本，仅在加载时访问
+	includes map[string]Version
+	// 支持推送的被引用配置收到的通知次数，及上次加载成功时的次数
+	includesGen       uint64
+	loadedIncludesGen uint64
+
+	// Asyncer.Watch返回的通知：配置自身（及签名）、被引用的配置，Close或不再引用时取消
+	watchMu        sync.Mutex
+	watches        map[string]chan struct{}
+	includeWatches map[string]chan struct{}
+
+	// 加载时被解密的节点，Set写回Asyncer时重新加密
+	encryptedPaths []string
+
+	// 校验内容签名的公钥，为空时不校验
+	trustedKeys TrustedKeys
+
+	// 是否解析YAML的!env、!file标签，见WithLocalTags
+	localTags bool
+
+	// 配置使用了引用、条件值或YAML标签，不支持Set
+	composed bool
+
+	// 配置中是否有${...}引用，加载及Set时计算
+	references int32
 }
 
-func (cfg *asyncConfig) watch(notify chan struct{}) {
+func (cfg *asyncConfig) watch(notify chan struct{}, include bool) {
 	for {
 		select {
-		case <-notify:
+		case _, ok := <-notify:
+			if !ok { // asyncer closed or unwatched
+				return
+			}
+			if include {
+				atomic.AddUint64(&cfg.includesGen, 1)
+			}
 			cfg.refresh()
 
-		//TODO
 		case <-cfg.quit:
 			return
 		}
 	}
 }
 
+func (cfg *asyncConfig) isClosed() bool {
+	return atomic.LoadInt32(&cfg.closed) == 1
+}
+
+func (cfg *asyncConfig) Close() error {
+	if !atomic.CompareAndSwapInt32(&cfg.closed, 0, 1) {
+		return ErrClosed
+	}
+
+	close(cfg.quit)
+	cfg.watchers.close()
+	cfg.unwatchAll()
+	trackSecrets(cfg, nil)
+
+	return nil
+}
+
 func (cfg *asyncConfig) Get(keyPath string) interface{} {
 	now := _now().UnixNano()
 	refreshTime := atomic.LoadInt64(&cfg.refreshTime)
-	if cfg.cacheTime > 0 && time.Duration(now-refreshTime)*time.Nanosecond > cfg.cacheTime { // content expired
+	if cfg.cacheTime > 0 && time.Duration(now-refreshTime)*time.Nanosecond > cfg.cacheTime && !cfg.isClosed() { // content expired
 		if refreshTime > 0 && cfg.refreshAsync { // if the content initialized and refreshAsync setted
 			logger.Debugf("asyncer[%s] refresh async", cfg.asyncKey)
 			go cfg.refresh()
@@ -146,86 +263,388 @@ func (cfg *asyncConfig) Get(keyPath string) interface{} {
 }
 
 func (cfg *asyncConfig) refresh() {
+	if cfg.isClosed() {
+		return
+	}
+
 	cfg.sf.Do("", func() (_ interface{}, _ error) {
 		atomic.StoreInt64(&cfg.refreshTime, _now().UnixNano())
 
-		rawMessage := cfg.asyncer.Get(cfg.asyncKey)
-		rawMessage = processRawMessage(rawMessage, cfg.contentType)
+		cfg.setLoadResult(cfg.load())
+
+		return
+	})
+}
 
-		if len(rawMessage) == 0 {
+func (cfg *asyncConfig) load() error {
+	ctx, cancel := cfg.fetchContext()
+	defer cancel()
+
+	rawMessage, version, err := cfg.asyncer.Get(ctx, cfg.asyncKey)
+	if err != nil {
+		if err == ErrEmptyContent {
 			logger.Warnf("asyncer[%s] get empty content", cfg.asyncKey)
-			return
+		} else {
+			logger.Errorf("asyncer[%s] get content err:%v", cfg.asyncKey, err)
 		}
+		return err
+	}
 
-		rawMessageMd5 := fmt.Sprintf("%x", md5.Sum(rawMessage))
-
-		// no change
-		if rawMessageMd5 == cfg.rawMessageMd5 {
-			return
+	// 签名无效的内容被拒绝，继续使用之前的内容
+	// 先于版本检查，版本不变而内容或签名变化时同样重新校验
+	var sigVersion Version
+	if len(cfg.trustedKeys) > 0 {
+		verified, v, err := verifyContent(ctx, cfg.asyncer, cfg.asyncKey, rawMessage, cfg.trustedKeys)
+		if err != nil {
+			return cfg.reject(rawMessage, fmt.Sprintf("%x", md5.Sum(rawMessage)), err)
 		}
+		rawMessage, sigVersion = verified, v
+	}
 
-		var val interface{}
-		if err := cfg.marshaler.Unmarshal(rawMessage, &val); err != nil {
-			logger.Errorf("unmarshal async config[%s] error:%v", cfg.asyncKey, err)
-			return
+	// 实例属性或被引用的配置变化时，内容不变也需要重新解析
+	// 被引用的配置只在内容不变时检查，支持推送的只在收到通知后重新加载
+	attrs, attrsGen := instanceAttributes()
+	includesGen := atomic.LoadUint64(&cfg.includesGen)
+	var depsChanged *bool
+	unchanged := func() bool {
+		if depsChanged == nil {
+			changed := attrsGen != cfg.attrsGen || includesGen != cfg.loadedIncludesGen ||
+				includesChanged(ctx, cfg.asyncer, cfg.includes, cfg.isIncludeWatched)
+			depsChanged = &changed
 		}
-		cfg.rawMessageMd5 = rawMessageMd5
-		cfg.value.Store(val)
+		return !*depsChanged
+	}
+
+	// no change
+	if version != "" && version == cfg.getVersion() && unchanged() {
+		return nil
+	}
+
+	rawMessage = processRawMessage(rawMessage, cfg.contentType)
+
+	if len(rawMessage) == 0 {
+		logger.Warnf("asyncer[%s] get empty content", cfg.asyncKey)
+		return ErrEmptyContent
+	}
+
+	rawMessageMd5 := fmt.Sprintf("%x", md5.Sum(rawMessage))
+
+	// no change
+	if rawMessageMd5 == cfg.rawMessageMd5 && unchanged() {
+		cfg.setVersion(version)
+		cfg.accept(version, sigVersion, cfg.includes)
+		return nil
+	}
+
+	tags := &yamlTagOptions{local: cfg.localTags}
+	val, err := unmarshalContent(rawMessage, cfg.contentType, tags)
+	if err != nil {
+		logger.Errorf("unmarshal async config[%s] error:%v", cfg.asyncKey, err)
+		return errors.Wrap(err, "unmarshal")
+	}
+	val, includes, err := resolveIncludes(ctx, cfg.asyncer, cfg.asyncKey, val, cfg.trustedKeys, tags)
+	if err != nil {
+		logger.Errorf("async config[%s] include error:%v", cfg.asyncKey, err)
+		return err
+	}
+	composed := len(includes) > 0 || tags.tagged || hasSelectors(val)
+	val = resolveSelectors(val, attrs)
+	val, encryptedPaths, err := decryptValues(val)
+	if err != nil {
+		logger.Errorf("async config[%s] decrypt error:%v", cfg.asyncKey, err)
+		return err
+	}
+	references := hasInterpolation(val)
+	if err := checkInterpolations(val); err != nil {
+		// 保持兼容，有语法错误的字符串读取时保持原样
+		logger.Warnf("async config[%s] interpolation:%v", cfg.asyncKey, err)
+	}
 
-		cfg.notify()
+	cfg.Lock()
+	oldVal := cfg.value.Load()
+	if err := cfg.validate(val, oldVal); err != nil {
+		cfg.Unlock()
+		return cfg.reject(rawMessage, rawMessageMd5, err)
+	}
+	cfg.rawMessageMd5 = rawMessageMd5
+	cfg.attrsGen = attrsGen
+	cfg.includes = includes
+	cfg.loadedIncludesGen = includesGen
+	cfg.encryptedPaths = encryptedPaths
+	cfg.composed = composed
+	trackSecrets(cfg, append(secretValues(val, encryptedPaths), tags.secrets...))
+	cfg.setVersion(version)
+	cfg.clearRejected()
+	cfg.storeValue(val, references)
+	cfg.enqueueChanges(oldVal, val)
+	cfg.Unlock()
+
+	cfg.accept(version, sigVersion, includes)
+	cfg.watchIncludes(includes)
+
+	cfg.watchers.dispatch()
+
+	return nil
+}
 
+// accept 通知Asyncer内容、分离签名及被引用的配置已被接受（见CachedAsyncer）
+func (cfg *asyncConfig) accept(version, sigVersion Version, includes map[string]Version) {
+	a, ok := cfg.asyncer.(accepter)
+	if !ok {
 		return
-	})
+	}
+
+	a.Accept(cfg.asyncKey, version)
+	if sigVersion != "" {
+		a.Accept(cfg.asyncKey+SignatureSuffix, sigVersion)
+	}
+	for key, v := range includes {
+		a.Accept(key, v)
+	}
+}
+
+// watchKey 监听key的变化，返回Asyncer是否支持推送
+func (cfg *asyncConfig) watchKey(key string, include bool) bool {
+	cfg.watchMu.Lock()
+	defer cfg.watchMu.Unlock()
+
+	return cfg.watchKeyLocked(key, include)
 }
 
-// Set 设置配置
+func (cfg *asyncConfig) watchKeyLocked(key string, include bool) bool {
+	notify := cfg.asyncer.Watch(key)
+	if notify == nil {
+		return false
+	}
+	if cfg.isClosed() {
+		cfg.unwatch(key, notify)
+		return true
+	}
+
+	watches := &cfg.watches
+	if include {
+		watches = &cfg.includeWatches
+	}
+	if *watches == nil {
+		*watches = make(map[string]chan struct{})
+	}
+	(*watches)[key] = notify
+	go cfg.watch(notify, include)
+
+	return true
+}
+
+// watchIncludes 监听被引用的配置的变化，并取消不再引用的配置的监听
+func (cfg *asyncConfig) watchIncludes(includes map[string]Version) {
+	cfg.watchMu.Lock()
+	defer cfg.watchMu.Unlock()
+
+	for key, notify := range cfg.includeWatches {
+		if _, ok := includes[key]; !ok {
+			delete(cfg.includeWatches, key)
+			cfg.unwatch(key, notify)
+		}
+	}
+	for key := range includes {
+		if _, ok := cfg.includeWatches[key]; !ok {
+			cfg.watchKeyLocked(key, true)
+		}
+	}
+}
+
+func (cfg *asyncConfig) isIncludeWatched(key string) bool {
+	cfg.watchMu.Lock()
+	defer cfg.watchMu.Unlock()
+
+	_, ok := cfg.includeWatches[key]
+	return ok
+}
+
+// unwatchAll 取消所有监听
+func (cfg *asyncConfig) unwatchAll() {
+	cfg.watchMu.Lock()
+	defer cfg.watchMu.Unlock()
+
+	for key, notify := range cfg.watches {
+		cfg.unwatch(key, notify)
+	}
+	for key, notify := range cfg.includeWatches {
+		cfg.unwatch(key, notify)
+	}
+	cfg.watches = nil
+	cfg.includeWatches = nil
+}
+
+// unwatch Asyncer不支持取消时，监听的goroutine在Close时退出
+func (cfg *asyncConfig) unwatch(key string, notify chan struct{}) {
+	if u, ok := cfg.asyncer.(unwatcher); ok {
+		u.Unwatch(key, notify)
+	}
+}
+
+// Set 设置配置，并将设置后的配置写回Asyncer（加载时被解密的节点重新加密）
+// 需校验签名的配置（见WithTrustedKeys）返回ErrSignedConfig；
+// 使用了引用、条件值或YAML标签的配置返回ErrComposedConfig，避免写回时丢失这些内容
 //
 // 注意：配置自动刷新会覆盖手动设置的同名配置值
 func (cfg *asyncConfig) Set(keyPath string, value interface{}) error {
+	if cfg.isClosed() {
+		return ErrClosed
+	}
+	if len(cfg.trustedKeys) > 0 {
+		return ErrSignedConfig
+	}
+	if cfg.isComposed() {
+		return ErrComposedConfig
+	}
+
+	newVal, err := cfg.set(keyPath, value)
+	if err != nil {
+		return err
+	}
+
+	cfg.watchers.dispatch()
+
+	encrypted, err := cfg.reencrypt(newVal)
+	if err != nil {
+		return err
+	}
+	data, err := cfg.marshaler.Marshal(encrypted)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cfg.fetchContext()
+	defer cancel()
+
+	return cfg.asyncer.Set(ctx, cfg.asyncKey, data, "")
+}
+
+func (cfg *asyncConfig) isComposed() bool {
+	cfg.Lock()
+	defer cfg.Unlock()
+	return cfg.composed
+}
+
+func (cfg *asyncConfig) fetchContext() (context.Context, context.CancelFunc) {
+	if cfg.fetchTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), cfg.fetchTimeout)
+}
+
+func (cfg *asyncConfig) getVersion() Version {
+	cfg.statusMu.RLock()
+	defer cfg.statusMu.RUnlock()
+	return cfg.version
+}
+
+func (cfg *asyncConfig) setVersion(version Version) {
+	cfg.statusMu.Lock()
+	defer cfg.statusMu.Unlock()
+	cfg.version = version
+}
+
+func (cfg *asyncConfig) set(keyPath string, value interface{}) (newVal interface{}, err error) {
 	cfg.Lock()
 	defer cfg.Unlock()
 
-	var iorigin interface{}
+	oldVal := cfg.value.Load()
 
 	if keyPath == RootKey {
-		cfg.value.Store(value)
+		newVal = value
 	} else {
-		iorigin = cfg.value.Load()
+		iorigin := oldVal
 		if iorigin == nil {
 			iorigin = make(map[string]interface{})
 		}
 		origin, ok := iorigin.(map[string]interface{})
 		if !ok {
-			return errors.Errorf("Set config[%s] %s=%v error", cfg.asyncKey, keyPath, value)
+			return nil, errors.Errorf("Set config[%s] %s=%v error", cfg.asyncKey, keyPath, value)
 		}
 		newValue := deepcopy.Copy(origin).(map[string]interface{})
 		if err := setMapValue(newValue, keyPath, value); err != nil {
-			return err
+			return nil, err
 		}
-		cfg.value.Store(newValue)
+		newVal = newValue
 	}
 
-	data, err := cfg.marshaler.Marshal(cfg.value.Load())
-	if err != nil {
-		return err
+	if err := cfg.validate(newVal, oldVal); err != nil {
+		return nil, err
 	}
 
-	cfg.notify()
+	cfg.storeValue(newVal, hasInterpolation(newVal))
+	cfg.enqueueChanges(oldVal, newVal)
 
-	return cfg.asyncer.Set(cfg.asyncKey, data)
+	return
 }
 
-func (cfg *asyncConfig) notify() {
-	for _, notifier := range cfg.notifiers {
-		select {
-		case notifier <- struct{}{}:
-		default:
-		}
+// storeValue 更新配置值及是否有引用，有引用时先更新标记，避免读取到未解析的引用
+func (cfg *asyncConfig) storeValue(val interface{}, references bool) {
+	if references {
+		atomic.StoreInt32(&cfg.references, 1)
+		cfg.value.Store(val)
+		return
 	}
+
+	cfg.value.Store(val)
+	atomic.StoreInt32(&cfg.references, 0)
 }
 
-func (cfg *asyncConfig) Watch(notifier chan struct{}) {
+// isLocal 开启了本地标签（见WithLocalTags）的配置为本地配置
+func (cfg *asyncConfig) isLocal() bool {
+	return cfg.localTags
+}
+
+func (cfg *asyncConfig) hasReferences() bool {
+	return atomic.LoadInt32(&cfg.references) == 1
+}
+
+// enqueueChanges 登记配置变更的通知，需持有cfg.Lock，保证通知顺序与变更顺序一致
+func (cfg *asyncConfig) enqueueChanges(oldVal, newVal interface{}) {
+	cfg.watchers.enqueue(func() {
+		cfg.watchers.notify()
+		cfg.watchers.notifyChanges(oldVal, newVal)
+	})
+}
+
+// reencrypt 返回加载时被解密的节点重新加密后的配置，避免Set时将明文写回Asyncer
+func (cfg *asyncConfig) reencrypt(val interface{}) (interface{}, error) {
 	cfg.Lock()
-	defer cfg.Unlock()
-	cfg.notifiers = append(cfg.notifiers, notifier)
+	paths := cfg.encryptedPaths
+	cfg.Unlock()
+
+	m, ok := val.(map[string]interface{})
+	if len(paths) == 0 || !ok {
+		return val, nil
+	}
+
+	p := keyProvider()
+	if p == nil {
+		return nil, ErrNoKeyProvider
+	}
+	m = deepcopy.Copy(m).(map[string]interface{})
+	for _, keyPath := range paths {
+		plaintext, ok := object.GetValue(m, keyPath)
+		if s, isString := plaintext.(string); ok && isString {
+			encrypted, err := EncryptValue(p, s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "encrypt path[%s]", keyPath)
+			}
+			if err := setMapValue(m, keyPath, encrypted); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (cfg *asyncConfig) Watch(notifier chan struct{}) Subscription {
+	return cfg.watchers.addNotifier(notifier)
+}
+
+func (cfg *asyncConfig) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return cfg.watchers.addKeyWatcher(keyPath, fn)
 }
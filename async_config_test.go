@@ -1,6 +1,8 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -26,6 +28,7 @@ func TestAsyncConfig(t *testing.T) {
 	asyncer.Set(asyncKey, []byte(`{"custom":"custom"}`))
 	cfg := NewAsyncConfig(asyncer, asyncKey, 1000*time.Millisecond, false)
 	ast.Equal("custom", cfg.Get("custom"))
+	ast.Equal(tb, cfg.Status().LoadTime)
 	// get count = 1
 	ast.EqualValues(1, cfg.Get("ct"))
 	ast.EqualValues(1, cfg.Get("ct"))
@@ -69,4 +72,117 @@ a: 2
 `))
 	time.Sleep(1 * time.Millisecond) // wait for update
 	ast.EqualValues(2, cfg3.Get("a"))
+
+	// wait for the in-flight refresh before restoring _now
+	cfg2.Configer.(*asyncConfig).refresh()
+	cfg3.Configer.(*asyncConfig).refresh()
+	cfg3.Close()
+}
+
+func TestAsyncConfigClose(t *testing.T) {
+	ast := assert.New(t)
+
+	asyncer := NewMockAsyncer(true)
+	asyncKey := "close_key"
+	asyncer.Set(asyncKey, []byte(`{"a":1}`))
+	cfg := NewAsyncConfig(asyncer, asyncKey, 0, false)
+
+	notifier := make(chan struct{}, 1)
+	cfg.Watch(notifier)
+
+	ast.Nil(cfg.Close())
+	ast.Equal(ErrClosed, cfg.Close())
+	ast.Equal(ErrClosed, cfg.Set("a", 2))
+
+	asyncer.Set(asyncKey, []byte(`{"a":3}`))
+	time.Sleep(1 * time.Millisecond)
+	ast.EqualValues(1, cfg.Get("a"))
+	ast.Len(notifier, 0)
+}
+
+func TestAsyncConfigReady(t *testing.T) {
+	ast := assert.New(t)
+
+	originInterval := _loadRetryInterval
+	defer func() {
+		_loadRetryInterval = originInterval
+	}()
+	_loadRetryInterval = time.Millisecond
+
+	asyncer := NewMockAsyncer(false)
+	asyncKey := "ready_key"
+	cfg := NewAsyncConfig(asyncer, asyncKey, 0, false, WithRequired(true))
+
+	status := cfg.Status()
+	ast.False(status.Ready)
+	ast.True(status.Required)
+	ast.Equal(ErrEmptyContent, status.LastError)
+	data, err := json.Marshal(status)
+	ast.Nil(err)
+	ast.Contains(string(data), `"last_error":"empty config content"`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	ast.NotNil(cfg.WaitReady(ctx))
+
+	c := newConfig()
+	c.AddLayer(DefaultLayerName, NewMapConfig(nil))
+	c.AddLayer(asyncKey, cfg)
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel2()
+	err = c.WaitReady(ctx2)
+	if ast.NotNil(err) {
+		ast.Contains(err.Error(), asyncKey)
+	}
+
+	// background retry picks up the content
+	asyncer.Set(asyncKey, []byte(`{"a":1}`))
+	ast.Nil(c.WaitReady(context.Background()))
+	ast.EqualValues(1, cfg.Get("a"))
+
+	statuses := c.Status()
+	ast.Len(statuses, 2)
+	ast.Equal(DefaultLayerName, statuses[0].Layer)
+	ast.True(statuses[0].Ready)
+	ast.Equal(asyncKey, statuses[1].Layer)
+	ast.True(statuses[1].Ready)
+	ast.Nil(statuses[1].LastError)
+	ast.Equal("", statuses[1].LastErrorMessage)
+	cfg.Close()
+}
+
+func TestAsyncConfigSetComposed(t *testing.T) {
+	ast := assert.New(t)
+
+	remote := &slowAsyncer{data: map[string][]byte{
+		"set_plain":    []byte(`{"a": 1, "b": {"c": 2}}`),
+		"set_include":  []byte(`{"$include": "set_common", "a": 1}`),
+		"set_common":   []byte(`{"b": 1}`),
+		"set_selector": []byte(`{"a": 1, "a@env=set_test": 2}`),
+	}}
+
+	cfg := NewAsyncConfig(remote, "set_plain", 0, false)
+	defer cfg.Close()
+	ast.Nil(cfg.Set("b.c", 3))
+	ast.JSONEq(`{"a": 1, "b": {"c": 3}}`, string(remote.Get("set_plain")))
+
+	// writing back the resolved tree would drop includes and selectors
+	for _, key := range []string{"set_include", "set_selector"} {
+		raw := string(remote.Get(key))
+		cfg := NewAsyncConfig(remote, key, 0, false)
+		ast.EqualValues(1, cfg.Get("a"), key)
+		ast.Equal(ErrComposedConfig, cfg.Set("a", 3), key)
+		ast.EqualValues(1, cfg.Get("a"), key)
+		ast.Equal(raw, string(remote.Get(key)), key)
+		cfg.Close()
+	}
+
+	yamlRemote := yamlAsyncer{&slowAsyncer{data: map[string][]byte{
+		"set_tag": []byte("token: !base64 aGVsbG8=\n"),
+	}}}
+	tagged := NewAsyncConfig(yamlRemote, "set_tag", 0, false)
+	defer tagged.Close()
+	ast.Equal("hello", tagged.String("token"))
+	ast.Equal(ErrComposedConfig, tagged.Set("token", "x"))
+	ast.Equal("token: !base64 aGVsbG8=\n", string(yamlRemote.Get("set_tag")))
 }
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/techxmind/go-utils/fileutil"
+)
+
+// staler 由能够返回过期（缓存）内容的Asyncer实现
+type staler interface {
+	Stale(key string) bool
+}
+
+// accepter 由需要知道内容是否被配置层接受的AsyncerV2实现，如CachedAsyncer只缓存被接受的内容
+type accepter interface {
+	Accept(key string, version Version)
+}
+
+type cacheItem struct {
+	content []byte
+	stale   bool
+}
+
+// pendingItem 已获取但尚未被配置层接受的内容
+type pendingItem struct {
+	content []byte
+	version Version
+}
+
+// CachedAsyncer 为任意Asyncer提供本地快照缓存（last-known-good）
+//
+// 获取的内容被配置层接受后（通过校验、签名检查等）才会原子地写入缓存目录；
+// 获取失败时返回缓存的内容并标记为过期（Stale），使服务在远程配置不可用时仍能以最近一次的配置启动。
+// 原生支持AsyncerV2的Asyncer返回内容为空（Key不存在或被删除）时删除缓存；
+// 不支持AsyncerV2的Asyncer无法区分内容为空与获取失败，均视为获取失败，返回缓存的内容
+type CachedAsyncer struct {
+	Asyncer
+	inner   AsyncerV2
+	empty   bool // inner能否区分内容为空与获取失败
+	dir     string
+	items   sync.Map //[string]*cacheItem
+	pending sync.Map //[string]*pendingItem
+}
+
+// NewCachedAsyncer 使用cacheDir作为缓存目录包装asyncer
+func NewCachedAsyncer(asyncer Asyncer, cacheDir string) *CachedAsyncer {
+	if err := fileutil.TouchDirAll(cacheDir); err != nil {
+		logger.Errorf("config cache dir[%s] err:%v", cacheDir, err)
+	}
+
+	return &CachedAsyncer{
+		Asyncer: asyncer,
+		inner:   AdaptAsyncer(asyncer),
+		empty:   reportsEmpty(asyncer),
+		dir:     cacheDir,
+	}
+}
+
+func (a *CachedAsyncer) cacheFile(key string) string {
+	return filepath.Join(a.dir, url.PathEscape(key)+".cache")
+}
+
+func (a *CachedAsyncer) Get(key string) []byte {
+	content, _, _ := a.get(context.Background(), key)
+
+	return content
+}
+
+func (a *CachedAsyncer) Set(key string, content []byte) error {
+	if err := a.Asyncer.Set(key, content); err != nil {
+		return err
+	}
+
+	a.save(key, content)
+
+	return nil
+}
+
+// V2 返回支持context、错误及版本的实现，被包装的Asyncer不支持AsyncerV2时通过AdaptAsyncer转换
+func (a *CachedAsyncer) V2() AsyncerV2 {
+	return &cachedAsyncerV2{a}
+}
+
+type cachedAsyncerV2 struct {
+	a *CachedAsyncer
+}
+
+func (v *cachedAsyncerV2) ContentType(key string) ContentType {
+	return v.a.inner.ContentType(key)
+}
+
+func (v *cachedAsyncerV2) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	return v.a.get(ctx, key)
+}
+
+func (v *cachedAsyncerV2) Set(ctx context.Context, key string, content []byte, ifVersion Version) error {
+	if err := v.a.inner.Set(ctx, key, content, ifVersion); err != nil {
+		return err
+	}
+
+	v.a.save(key, content)
+
+	return nil
+}
+
+func (v *cachedAsyncerV2) Watch(key string) chan struct{} {
+	return v.a.inner.Watch(key)
+}
+
+func (v *cachedAsyncerV2) Unwatch(key string, ch chan struct{}) {
+	if u, ok := v.a.inner.(unwatcher); ok {
+		u.Unwatch(key, ch)
+	}
+}
+
+func (v *cachedAsyncerV2) Stale(key string) bool {
+	return v.a.Stale(key)
+}
+
+// Accept 写入key已被配置层接受的版本的内容
+func (v *cachedAsyncerV2) Accept(key string, version Version) {
+	p, ok := v.a.pending.Load(key)
+	if !ok {
+		return
+	}
+	if item := p.(*pendingItem); item.version == version {
+		v.a.save(key, item.content)
+	}
+}
+
+// get 获取成功的内容待接受后写入缓存（见Accept），内容为空时删除缓存，获取失败时返回缓存的内容
+func (a *CachedAsyncer) get(ctx context.Context, key string) ([]byte, Version, error) {
+	content, version, err := a.inner.Get(ctx, key)
+	if err == nil {
+		a.pending.Store(key, &pendingItem{
+			content: content,
+			version: version,
+		})
+		a.markFresh(key)
+		return content, version, nil
+	}
+	if err == ErrEmptyContent && a.empty {
+		a.remove(key)
+		return nil, "", err
+	}
+
+	cached := a.load(key)
+	if len(cached) == 0 {
+		return nil, "", err
+	}
+	logger.Warnf("asyncer[%s] unavailable, serve cached content: %v", key, err)
+
+	return cached, contentVersion(cached), nil
+}
+
+// Stale 返回key当前的内容是否来自本地缓存
+func (a *CachedAsyncer) Stale(key string) bool {
+	if item, ok := a.items.Load(key); ok && item.(*cacheItem).stale {
+		return true
+	}
+	if s, ok := a.Asyncer.(staler); ok {
+		return s.Stale(key)
+	}
+
+	return false
+}
+
+// Unwrap 返回被包装的Asyncer
+func (a *CachedAsyncer) Unwrap() Asyncer {
+	return a.Asyncer
+}
+
+// Close 关闭被包装的Asyncer
+func (a *CachedAsyncer) Close() error {
+	if closer, ok := a.Asyncer.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// save 内容变化时写入缓存文件（写临时文件后rename，保证原子性）
+func (a *CachedAsyncer) save(key string, content []byte) {
+	if item, ok := a.items.Load(key); ok {
+		if it := item.(*cacheItem); !it.stale && bytes.Equal(it.content, content) {
+			return
+		}
+	}
+
+	a.items.Store(key, &cacheItem{
+		content: content,
+	})
+
+	if err := writeFileAtomic(a.cacheFile(key), content); err != nil {
+		logger.Errorf("save config cache[%s] err:%v", key, err)
+	}
+}
+
+// markFresh 远程获取成功后，取消缓存内容的过期标记
+func (a *CachedAsyncer) markFresh(key string) {
+	if item, ok := a.items.Load(key); ok {
+		if it := item.(*cacheItem); it.stale {
+			a.items.Store(key, &cacheItem{
+				content: it.content,
+			})
+		}
+	}
+}
+
+// remove Key不存在或内容为空时删除缓存，避免之后返回已删除的内容
+func (a *CachedAsyncer) remove(key string) {
+	a.pending.Delete(key)
+	a.items.Delete(key)
+
+	if err := os.Remove(a.cacheFile(key)); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("remove config cache[%s] err:%v", key, err)
+	}
+}
+
+// load 读取缓存内容，并标记为过期
+func (a *CachedAsyncer) load(key string) []byte {
+	if item, ok := a.items.Load(key); ok {
+		it := item.(*cacheItem)
+		if !it.stale {
+			a.items.Store(key, &cacheItem{
+				content: it.content,
+				stale:   true,
+			})
+		}
+		return it.content
+	}
+
+	content, err := ioutil.ReadFile(a.cacheFile(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("read config cache[%s] err:%v", key, err)
+		}
+		return nil
+	}
+
+	a.items.Store(key, &cacheItem{
+		content: content,
+		stale:   true,
+	})
+
+	return content
+}
+
+func writeFileAtomic(file string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+
+	if _, err = f.Write(content); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, file)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+	}
+
+	return err
+}
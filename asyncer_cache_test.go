@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/techxmind/go-utils/object"
+)
+
+func TestCachedAsyncer(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unexpected ioutil.TempDir error: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	key := "cached/key"
+	remote := NewMockAsyncer(false)
+	remote.Set(key, []byte(`{"a":1}`))
+
+	asyncer := NewCachedAsyncer(remote, tmpdir)
+	cfg := NewAsyncConfig(asyncer, key, 0, false)
+	ast.EqualValues(1, cfg.Get("a"))
+	ast.False(asyncer.Stale(key))
+	ast.FileExists(asyncer.cacheFile(key))
+
+	// restart while remote is unavailable
+	down := &flakyAsyncer{MockAsyncer: NewMockAsyncer(false), down: 1}
+	asyncer = NewCachedAsyncer(down, tmpdir)
+	cfg = NewAsyncConfig(asyncer, key, 0, false, WithRequired(true))
+	ast.EqualValues(1, cfg.Get("a"))
+	ast.True(asyncer.Stale(key))
+
+	status := cfg.Status()
+	ast.True(status.Ready)
+	ast.True(status.Stale)
+
+	// asyncers without AsyncerV2 report failures as empty content, the cache is served instead of removed
+	asyncer = NewCachedAsyncer(NewResilientAsyncer(NewMockAsyncer(false), nil), tmpdir)
+	cfg = NewAsyncConfig(asyncer, key, 0, false, WithRequired(true))
+	ast.EqualValues(1, cfg.Get("a"))
+	ast.True(asyncer.Stale(key))
+	ast.FileExists(asyncer.cacheFile(key))
+
+	// remote recovered
+	remote = NewMockAsyncer(false)
+	remote.Set(key, []byte(`{"a":2}`))
+	asyncer = NewCachedAsyncer(&flakyAsyncer{MockAsyncer: remote}, tmpdir)
+	cfg = NewAsyncConfig(asyncer, key, time.Millisecond, false, WithValidator(func(newTree, _ interface{}) error {
+		if v, _ := object.GetValue(newTree, "a"); v == int64(3) {
+			return errors.New("a=3 not allowed")
+		}
+		return nil
+	}))
+	ast.EqualValues(2, cfg.Get("a"))
+	ast.False(cfg.Status().Stale)
+
+	content, err := ioutil.ReadFile(asyncer.cacheFile(key))
+	ast.Nil(err)
+	ast.Contains(string(content), `"a":2`)
+
+	// rejected content is not cached
+	remote.Set(key, []byte(`{"a":3}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(2, cfg.Get("a"))
+	ast.NotNil(cfg.Rejected())
+	content, err = ioutil.ReadFile(asyncer.cacheFile(key))
+	ast.Nil(err)
+	ast.Contains(string(content), `"a":2`)
+
+	// deleted content of an AsyncerV2 removes the cache instead of serving it
+	remote.Set(key, nil)
+	time.Sleep(2 * time.Millisecond)
+	cfg.Get("a")
+	ast.NoFileExists(asyncer.cacheFile(key))
+	ast.False(asyncer.Stale(key))
+}
+
+func TestWrappedAsyncerV2(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unexpected ioutil.TempDir error: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	key := "wrapped_key"
+	remote := &flakyAsyncer{MockAsyncer: NewMockAsyncer(false)}
+	remote.MockAsyncer.Set(key, []byte(`{"a":1}`))
+
+	asyncer := AdaptAsyncer(NewCachedAsyncer(NewResilientAsyncer(remote, nil), tmpdir))
+	_, ok := asyncer.(*cachedAsyncerV2)
+	ast.True(ok)
+
+	ctx := context.Background()
+	content, version, err := asyncer.Get(ctx, key)
+	ast.Nil(err)
+	ast.Equal(contentVersion(content), version)
+
+	_, _, err = asyncer.Get(ctx, "missing")
+	ast.Equal(ErrEmptyContent, err)
+
+	ast.Equal(ErrVersionConflict, asyncer.Set(ctx, key, []byte(`{"a":2}`), "stale"))
+	ast.Nil(asyncer.Set(ctx, key, []byte(`{"a":2}`), ""))
+	ast.Contains(string(remote.MockAsyncer.Get(key)), `"a":2`)
+
+	// fetch errors of the inner asyncer are not hidden as empty content
+	atomic.StoreInt32(&remote.down, 1)
+	_, _, err = asyncer.Get(ctx, "missing")
+	ast.EqualError(err, "remote down")
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +17,7 @@ type fileItem struct {
 
 type FileAsyncer struct {
 	fileItems sync.Map
+	closed    int32
 }
 
 func NewFileAsyncer() *FileAsyncer {
@@ -31,6 +33,11 @@ func (a *FileAsyncer) ContentType(file string) ContentType {
 }
 
 func (a *FileAsyncer) Get(file string) []byte {
+	if atomic.LoadInt32(&a.closed) == 1 {
+		logger.Errorf("read conf file[%s] from closed file asyncer", file)
+		return nil
+	}
+
 	info, err := os.Stat(file)
 
 	if err != nil {
@@ -67,3 +74,17 @@ func (a *FileAsyncer) Set(file string, content []byte) error {
 func (a *FileAsyncer) Watch(file string) chan struct{} {
 	return nil
 }
+
+// Close 清除文件缓存，之后的Get返回nil
+func (a *FileAsyncer) Close() error {
+	if !atomic.CompareAndSwapInt32(&a.closed, 0, 1) {
+		return ErrClosed
+	}
+
+	a.fileItems.Range(func(key, _ interface{}) bool {
+		a.fileItems.Delete(key)
+		return true
+	})
+
+	return nil
+}
@@ -9,8 +9,10 @@ import (
 type MockAsyncer struct {
 	ct            int32
 	data          sync.Map
-	notifyChans   sync.Map
 	notifyEnabled bool
+
+	mu          sync.RWMutex
+	notifyChans map[string][]chan struct{}
 }
 
 func NewMockAsyncer(notifyEnabled bool) *MockAsyncer {
@@ -44,17 +46,17 @@ func (a *MockAsyncer) Get(key string) []byte {
 		return nil
 	}
 
-	atomic.AddInt32(&a.ct, 1)
+	ct := atomic.AddInt32(&a.ct, 1)
 	setMapValue(m, "key", key)
-	setMapValue(m, "ct", a.ct)
+	setMapValue(m, "ct", ct)
 	ret, _ := mar.Marshal(m)
-	logger.Infof("get async config[%s]:%s", key, ret)
+	logger.Infof("get async config[%s]:%s", key, redactContent(ret, a.ContentType(key)))
 	return ret
 }
 
 func (a *MockAsyncer) Set(key string, value []byte) error {
 	a.data.Store(key, value)
-	logger.Infof("set async config[%s]:%s", key, value)
+	logger.Infof("set async config[%s]:%s", key, redactContent(value, a.ContentType(key)))
 	a.notify(key)
 	return nil
 }
@@ -63,22 +65,46 @@ func (a *MockAsyncer) notify(key string) {
 	if !a.notifyEnabled {
 		return
 	}
-	if ch, ok := a.notifyChans.Load(key); ok {
-		ch.(chan struct{}) <- struct{}{}
-	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	notifyAll(a.notifyChans[key])
 }
 
+// Watch 每次调用返回独立的channel
 func (a *MockAsyncer) Watch(key string) chan struct{} {
 	if !a.notifyEnabled {
 		return nil
 	}
 
-	if ch, ok := a.notifyChans.Load(key); ok {
-		return ch.(chan struct{})
-	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
 	ch := make(chan struct{}, 1)
-	a.notifyChans.Store(key, ch)
+	if a.notifyChans == nil {
+		a.notifyChans = make(map[string][]chan struct{})
+	}
+	a.notifyChans[key] = append(a.notifyChans[key], ch)
 
 	return ch
 }
+
+func (a *MockAsyncer) Unwatch(key string, ch chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if chs, ok := removeNotifyChan(a.notifyChans[key], ch); ok {
+		a.notifyChans[key] = chs
+		if len(chs) == 0 {
+			delete(a.notifyChans, key)
+		}
+		close(ch)
+	}
+}
+
+// watching 返回key的监听者数量
+func (a *MockAsyncer) watching(key string) int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.notifyChans[key])
+}
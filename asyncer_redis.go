@@ -5,13 +5,19 @@ import (
 	"sync"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 )
 
 type RedisAsyncer struct {
 	db            *redis.Client
-	ctx           context.Context
 	notifyEnabled bool
-	notifyChans   sync.Map
+	sub           *redis.PubSub
+
+	// 每次Watch返回独立的channel，mu保护notifyChans的修改、发送与关闭
+	mu          sync.RWMutex
+	notifyChans map[string][]chan struct{}
+	closed      bool
 }
 
 // NewRedisAsyncer create new RedisAsyncer.
@@ -20,8 +26,7 @@ type RedisAsyncer struct {
 func NewRedisAsyncer(options *redis.Options, subChannel string) *RedisAsyncer {
 	db := redis.NewClient(options)
 	a := &RedisAsyncer{
-		db:  db,
-		ctx: context.Background(),
+		db: db,
 	}
 
 	if subChannel != "" {
@@ -40,13 +45,15 @@ func (a *RedisAsyncer) ContentType(key string) ContentType {
 }
 
 func (a *RedisAsyncer) subscribe(channel string) {
-	sub := a.db.Subscribe(a.ctx, channel)
-	_, err := sub.Receive(a.ctx)
+	ctx := context.Background()
+	sub := a.db.Subscribe(ctx, channel)
+	_, err := sub.Receive(ctx)
 	if err != nil {
 		logger.Errorf("redis subscribe channel=%s err=%v", channel, err)
 		return
 	}
 
+	a.sub = sub
 	a.notifyEnabled = true
 	go func() {
 		for msg := range sub.Channel() {
@@ -58,26 +65,63 @@ func (a *RedisAsyncer) subscribe(channel string) {
 }
 
 func (a *RedisAsyncer) Get(key string) []byte {
-	val, err := a.db.Get(a.ctx, key).Result()
-
-	if err == redis.Nil {
-		return nil
-	} else if err != nil {
+	content, _, err := a.GetContext(context.Background(), key)
+	if err != nil && err != ErrEmptyContent {
 		logger.Errorf("read conf[%s] from redis err:%v", key, err)
-		return nil
 	}
 
-	if val == "" {
-		return nil
+	return content
+}
+
+// GetContext 获取配置内容及版本（内容md5），不存在或为空时返回ErrEmptyContent
+func (a *RedisAsyncer) GetContext(ctx context.Context, key string) ([]byte, Version, error) {
+	if a.isClosed() {
+		return nil, "", ErrClosed
 	}
 
-	bs := []byte(val)
+	val, err := a.db.Get(ctx, key).Bytes()
+
+	if err == redis.Nil || (err == nil && len(val) == 0) {
+		return nil, "", ErrEmptyContent
+	} else if err != nil {
+		return nil, "", errors.Wrapf(err, "read conf[%s] from redis", key)
+	}
 
-	return bs
+	return val, contentVersion(val), nil
 }
 
 func (a *RedisAsyncer) Set(key string, content []byte) error {
-	err := a.db.Set(context.Background(), key, string(content), 0).Err()
+	return a.SetContext(context.Background(), key, content, "")
+}
+
+// SetContext 写入配置内容，ifVersion不为空时，通过WATCH保证仅当前版本与ifVersion一致时写入
+func (a *RedisAsyncer) SetContext(ctx context.Context, key string, content []byte, ifVersion Version) error {
+	if a.isClosed() {
+		return ErrClosed
+	}
+
+	var err error
+	if ifVersion == "" {
+		err = a.db.Set(ctx, key, string(content), 0).Err()
+	} else {
+		err = a.db.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if contentVersion(current) != ifVersion {
+				return ErrVersionConflict
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, string(content), 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err == redis.TxFailedErr {
+			err = ErrVersionConflict
+		}
+	}
 
 	if err == nil {
 		a.notify(key)
@@ -86,26 +130,106 @@ func (a *RedisAsyncer) Set(key string, content []byte) error {
 	return err
 }
 
+// V2 返回RedisAsyncer的AsyncerV2实现
+func (a *RedisAsyncer) V2() AsyncerV2 {
+	return redisAsyncerV2{a}
+}
+
+type redisAsyncerV2 struct {
+	a *RedisAsyncer
+}
+
+func (r redisAsyncerV2) ContentType(key string) ContentType {
+	return r.a.ContentType(key)
+}
+
+func (r redisAsyncerV2) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	return r.a.GetContext(ctx, key)
+}
+
+func (r redisAsyncerV2) Set(ctx context.Context, key string, value []byte, ifVersion Version) error {
+	return r.a.SetContext(ctx, key, value, ifVersion)
+}
+
+func (r redisAsyncerV2) Watch(key string) chan struct{} {
+	return r.a.Watch(key)
+}
+
+func (r redisAsyncerV2) Unwatch(key string, ch chan struct{}) {
+	r.a.Unwatch(key, ch)
+}
+
 func (a *RedisAsyncer) notify(key string) {
-	if a.notifyEnabled {
-		if ch, ok := a.notifyChans.Load(key); ok {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.notifyEnabled && !a.closed {
+		if chs := a.notifyChans[key]; len(chs) > 0 {
 			logger.Debugf("%s changed notify", key)
-			ch.(chan struct{}) <- struct{}{}
+			notifyAll(chs)
 		}
 	}
 }
 
+// Watch 监听key的变更，每次调用返回独立的channel，不再监听时调用Unwatch
 func (a *RedisAsyncer) Watch(key string) chan struct{} {
-	if !a.notifyEnabled {
-		return nil
-	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	if ch, ok := a.notifyChans.Load(key); ok {
-		return ch.(chan struct{})
+	if !a.notifyEnabled || a.closed {
+		return nil
 	}
 
 	ch := make(chan struct{}, 1)
-	a.notifyChans.Store(key, ch)
+	if a.notifyChans == nil {
+		a.notifyChans = make(map[string][]chan struct{})
+	}
+	a.notifyChans[key] = append(a.notifyChans[key], ch)
 
 	return ch
 }
+
+// Unwatch 取消Watch返回的ch的监听并关闭ch
+func (a *RedisAsyncer) Unwatch(key string, ch chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if chs, ok := removeNotifyChan(a.notifyChans[key], ch); ok {
+		a.notifyChans[key] = chs
+		if len(chs) == 0 {
+			delete(a.notifyChans, key)
+		}
+		close(ch)
+	}
+}
+
+func (a *RedisAsyncer) isClosed() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.closed
+}
+
+// Close 取消订阅并关闭redis连接，关闭所有Watch返回的channel
+func (a *RedisAsyncer) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	for _, chs := range a.notifyChans {
+		for _, ch := range chs {
+			close(ch)
+		}
+	}
+	a.notifyChans = nil
+	a.mu.Unlock()
+
+	var err error
+	if a.sub != nil {
+		err = multierr.Append(err, a.sub.Close())
+	}
+	err = multierr.Append(err, a.db.Close())
+
+	return err
+}
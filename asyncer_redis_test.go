@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	//"encoding/json"
 	"testing"
 	"time"
@@ -97,6 +98,54 @@ func (s *redisAsyncerTestSuite) TestNotify() {
 	s.EqualValues(2, redisCfg.Int("foo.bar"), "get foo.bar")
 }
 
+func (s *redisAsyncerTestSuite) TestClose() {
+	asyncer := NewRedisAsyncer(&redis.Options{
+		Addr: s.rds.Addr(),
+	}, s.notifyChannel)
+
+	redisCfg := NewAsyncConfig(
+		asyncer,
+		s.defaultKey,
+		5*time.Millisecond,
+		false,
+	)
+	s.EqualValues(1, redisCfg.Int("foo.bar"), "get foo.bar")
+
+	notify := asyncer.Watch(s.defaultKey)
+	s.Nil(asyncer.Close())
+	s.Equal(ErrClosed, asyncer.Close())
+	_, ok := <-notify
+	s.False(ok, "watch channel closed")
+	s.Nil(asyncer.Get(s.defaultKey))
+	s.Equal(ErrClosed, asyncer.Set(s.defaultKey, []byte(`{}`)))
+	s.Nil(redisCfg.Close())
+}
+
+func (s *redisAsyncerTestSuite) TestV2() {
+	asyncer := AdaptAsyncer(NewRedisAsyncer(&redis.Options{
+		Addr: s.rds.Addr(),
+	}, ""))
+	ctx := context.Background()
+
+	content, version, err := asyncer.Get(ctx, s.defaultKey)
+	s.Nil(err)
+	s.EqualValues(s.defaultValue, content)
+	s.Equal(contentVersion(content), version)
+
+	_, _, err = asyncer.Get(ctx, "not_exist_key")
+	s.Equal(ErrEmptyContent, err)
+
+	s.Equal(ErrVersionConflict, asyncer.Set(ctx, s.defaultKey, []byte(`{}`), "bad_version"))
+	s.Nil(asyncer.Set(ctx, s.defaultKey, []byte(`{}`), version))
+	_, version, _ = asyncer.Get(ctx, s.defaultKey)
+	s.Equal(contentVersion([]byte(`{}`)), version)
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = asyncer.Get(cancelCtx, s.defaultKey)
+	s.NotNil(err)
+}
+
 func TestRedisAsyncerTestSuite(t *testing.T) {
 	suite.Run(t, new(redisAsyncerTestSuite))
 }
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCircuitOpen Key处于熔断或退避期间，且没有可返回的内容
+	ErrCircuitOpen = errors.New("asyncer circuit open")
+)
+
+// ResilientOptions ResilientAsyncer的配置，零值字段使用默认值
+type ResilientOptions struct {
+	// 单次获取的超时时间，默认1s
+	Timeout time.Duration
+
+	// 失败后的退避时间，从MinBackoff开始指数增长至MaxBackoff，默认100ms ~ 30s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// 连续失败FailureThreshold次后熔断，熔断OpenTimeout后允许一次试探请求，默认5次、30s
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func (o *ResilientOptions) withDefaults() ResilientOptions {
+	opts := ResilientOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+		if opts.MaxBackoff < opts.MinBackoff {
+			opts.MaxBackoff = opts.MinBackoff
+		}
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+
+	return opts
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// breaker 单个Key的退避及熔断状态
+type breaker struct {
+	mu          sync.Mutex
+	state       circuitState
+	failures    int
+	nextAttempt time.Time
+	openUntil   time.Time
+	probing     bool
+}
+
+// ResilientAsyncer 为Asyncer的获取增加超时、失败退避及熔断，每个Key的退避及熔断相互独立
+//
+// 获取失败（超时或其它错误）、退避期间或熔断期间，不会阻塞调用方，
+// 直接返回最近一次成功获取的内容，并标记为过期（Stale）。
+// 内容为空（Key不存在或被删除）不视为失败，也不返回之前的内容；
+// 不支持AsyncerV2的Asyncer无法区分内容为空与获取失败，均视为内容为空
+type ResilientAsyncer struct {
+	Asyncer
+	inner AsyncerV2
+	opts  ResilientOptions
+	now   func() time.Time
+
+	breakers sync.Map //[string]*breaker
+	lastGood sync.Map //[string][]byte
+	stale    sync.Map //[string]bool
+}
+
+// NewResilientAsyncer 包装asyncer，opts为nil时使用默认配置
+func NewResilientAsyncer(asyncer Asyncer, opts *ResilientOptions) *ResilientAsyncer {
+	return &ResilientAsyncer{
+		Asyncer: asyncer,
+		inner:   AdaptAsyncer(asyncer),
+		opts:    opts.withDefaults(),
+		now:     time.Now,
+	}
+}
+
+func (a *ResilientAsyncer) Get(key string) []byte {
+	content, _, _ := a.get(context.Background(), key)
+
+	return content
+}
+
+func (a *ResilientAsyncer) Set(key string, content []byte) error {
+	if err := a.Asyncer.Set(key, content); err != nil {
+		return err
+	}
+
+	a.lastGood.Store(key, content)
+	a.stale.Delete(key)
+
+	return nil
+}
+
+// Stale 返回key当前的内容是否为过期内容
+func (a *ResilientAsyncer) Stale(key string) bool {
+	if _, ok := a.stale.Load(key); ok {
+		return true
+	}
+	if s, ok := a.Asyncer.(staler); ok {
+		return s.Stale(key)
+	}
+
+	return false
+}
+
+// Unwrap 返回被包装的Asyncer
+func (a *ResilientAsyncer) Unwrap() Asyncer {
+	return a.Asyncer
+}
+
+// Close 关闭被包装的Asyncer
+func (a *ResilientAsyncer) Close() error {
+	if closer, ok := a.Asyncer.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// V2 返回支持context、错误及版本的实现，被包装的Asyncer不支持AsyncerV2时通过AdaptAsyncer转换
+func (a *ResilientAsyncer) V2() AsyncerV2 {
+	return &resilientAsyncerV2{a}
+}
+
+type resilientAsyncerV2 struct {
+	a *ResilientAsyncer
+}
+
+func (v *resilientAsyncerV2) ContentType(key string) ContentType {
+	return v.a.inner.ContentType(key)
+}
+
+func (v *resilientAsyncerV2) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	return v.a.get(ctx, key)
+}
+
+func (v *resilientAsyncerV2) Set(ctx context.Context, key string, content []byte, ifVersion Version) error {
+	if err := v.a.inner.Set(ctx, key, content, ifVersion); err != nil {
+		return err
+	}
+
+	v.a.lastGood.Store(key, content)
+	v.a.stale.Delete(key)
+
+	return nil
+}
+
+func (v *resilientAsyncerV2) Watch(key string) chan struct{} {
+	return v.a.inner.Watch(key)
+}
+
+func (v *resilientAsyncerV2) Unwatch(key string, ch chan struct{}) {
+	if u, ok := v.a.inner.(unwatcher); ok {
+		u.Unwatch(key, ch)
+	}
+}
+
+func (v *resilientAsyncerV2) Stale(key string) bool {
+	return v.a.Stale(key)
+}
+
+// Accept 转发至被包装的Asyncer
+func (v *resilientAsyncerV2) Accept(key string, version Version) {
+	if a, ok := v.a.inner.(accepter); ok {
+		a.Accept(key, version)
+	}
+}
+
+// get 带超时的获取，只有获取错误计入失败；失败时返回最近一次成功获取的内容
+// 调用方ctx取消或超时导致的错误不计入失败，直接返回错误
+func (a *ResilientAsyncer) get(ctx context.Context, key string) ([]byte, Version, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	b := a.breaker(key)
+	if !b.allow(a.now()) {
+		return a.fallback(key, ErrCircuitOpen)
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, a.opts.Timeout)
+	defer cancel()
+
+	content, version, err := a.inner.Get(fetchCtx, key)
+	if err != nil && err != ErrEmptyContent && ctx.Err() != nil {
+		b.release()
+		return nil, "", err
+	}
+	b.record(a.now(), key, err == nil || err == ErrEmptyContent, &a.opts)
+
+	switch err {
+	case nil:
+		a.lastGood.Store(key, content)
+		a.stale.Delete(key)
+		return content, version, nil
+	case ErrEmptyContent:
+		a.lastGood.Delete(key)
+		a.stale.Delete(key)
+		return nil, "", err
+	}
+
+	if err == context.DeadlineExceeded {
+		logger.Warnf("asyncer[%s] get timeout after %v", key, a.opts.Timeout)
+	}
+
+	return a.fallback(key, err)
+}
+
+func (a *ResilientAsyncer) breaker(key string) *breaker {
+	b, _ := a.breakers.LoadOrStore(key, &breaker{})
+
+	return b.(*breaker)
+}
+
+// fallback 返回最近一次成功获取的内容并标记为过期，没有时返回err
+func (a *ResilientAsyncer) fallback(key string, err error) ([]byte, Version, error) {
+	content, ok := a.lastGood.Load(key)
+	if !ok {
+		return nil, "", err
+	}
+
+	a.stale.Store(key, true)
+
+	return content.([]byte), contentVersion(content.([]byte)), nil
+}
+
+// allow 返回当前是否允许请求远程
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		// 同一时刻只允许一个试探请求
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return !now.Before(b.nextAttempt)
+	}
+}
+
+// release 结束请求但不记录结果，试探请求被取消时允许下一次试探
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) record(now time.Time, key string, success bool, opts *ResilientOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if success {
+		if b.state != circuitClosed {
+			logger.Infof("asyncer[%s] circuit closed", key)
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		b.nextAttempt = time.Time{}
+		return
+	}
+
+	b.failures++
+	backoff := opts.MinBackoff
+	for i := 1; i < b.failures && backoff < opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > opts.MaxBackoff {
+		backoff = opts.MaxBackoff
+	}
+	b.nextAttempt = now.Add(backoff)
+
+	if b.state == circuitHalfOpen || b.failures >= opts.FailureThreshold {
+		if b.state != circuitOpen {
+			logger.Warnf("asyncer[%s] circuit open after %d failures", key, b.failures)
+		}
+		b.state = circuitOpen
+		b.openUntil = now.Add(opts.OpenTimeout)
+	}
+}
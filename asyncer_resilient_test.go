@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyAsyncer struct {
+	*MockAsyncer
+	calls int32
+	down  int32
+	delay time.Duration
+}
+
+func (a *flakyAsyncer) Get(key string) []byte {
+	atomic.AddInt32(&a.calls, 1)
+	time.Sleep(a.delay)
+	return a.MockAsyncer.Get(key)
+}
+
+func (a *flakyAsyncer) V2() AsyncerV2 {
+	return &flakyAsyncerV2{
+		asyncerAdapter: &asyncerAdapter{Asyncer: a},
+		flaky:          a,
+	}
+}
+
+// flakyAsyncerV2 down时返回获取错误
+type flakyAsyncerV2 struct {
+	*asyncerAdapter
+	flaky *flakyAsyncer
+}
+
+func (a *flakyAsyncerV2) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	if atomic.LoadInt32(&a.flaky.down) == 1 {
+		atomic.AddInt32(&a.flaky.calls, 1)
+		return nil, "", errors.New("remote down")
+	}
+
+	return a.asyncerAdapter.Get(ctx, key)
+}
+
+func TestResilientAsyncer(t *testing.T) {
+	ast := assert.New(t)
+
+	key := "resilient_key"
+	remote := &flakyAsyncer{MockAsyncer: NewMockAsyncer(false)}
+	remote.MockAsyncer.Set(key, []byte(`{"a":1}`))
+
+	tm := time.Now()
+	asyncer := NewResilientAsyncer(remote, &ResilientOptions{
+		Timeout:          10 * time.Millisecond,
+		MinBackoff:       time.Second,
+		MaxBackoff:       4 * time.Second,
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+	})
+	asyncer.now = func() time.Time { return tm }
+
+	ast.NotNil(asyncer.Get(key))
+	ast.False(asyncer.Stale(key))
+
+	// failure serves the last good content and backs off
+	atomic.StoreInt32(&remote.down, 1)
+	ast.NotNil(asyncer.Get(key))
+	ast.True(asyncer.Stale(key))
+	ast.EqualValues(2, remote.calls)
+	ast.NotNil(asyncer.Get(key))
+	ast.EqualValues(2, remote.calls, "no call during backoff")
+
+	tm = tm.Add(time.Second)
+	asyncer.Get(key)
+	ast.EqualValues(3, remote.calls)
+	tm = tm.Add(2 * time.Second)
+	asyncer.Get(key)
+	ast.EqualValues(4, remote.calls)
+	ast.Equal(circuitOpen, asyncer.breaker(key).state)
+
+	// circuit open: no calls even after backoff
+	tm = tm.Add(10 * time.Second)
+	asyncer.Get(key)
+	ast.EqualValues(4, remote.calls)
+
+	// half-open probe succeeds and closes the circuit
+	atomic.StoreInt32(&remote.down, 0)
+	tm = tm.Add(time.Minute)
+	ast.NotNil(asyncer.Get(key))
+	ast.EqualValues(5, remote.calls)
+	ast.Equal(circuitClosed, asyncer.breaker(key).state)
+	ast.False(asyncer.Stale(key))
+
+	// slow remote times out without blocking the caller
+	remote.delay = 50 * time.Millisecond
+	start := time.Now()
+	ast.NotNil(asyncer.Get(key))
+	ast.True(time.Since(start) < 40*time.Millisecond)
+	ast.True(asyncer.Stale(key))
+}
+
+func TestResilientAsyncerPerKey(t *testing.T) {
+	ast := assert.New(t)
+
+	remote := &flakyAsyncer{MockAsyncer: NewMockAsyncer(false)}
+	remote.MockAsyncer.Set("a", []byte(`{"a":1}`))
+	remote.MockAsyncer.Set("b", []byte(`{"b":1}`))
+
+	asyncer := NewResilientAsyncer(remote, &ResilientOptions{
+		MinBackoff:       time.Minute,
+		FailureThreshold: 1,
+	})
+
+	// missing keys (e.g. absent .sig) are not failures
+	for i := 0; i < 3; i++ {
+		ast.Nil(asyncer.Get("a" + SignatureSuffix))
+	}
+	ast.EqualValues(3, remote.calls)
+	ast.Equal(circuitClosed, asyncer.breaker("a"+SignatureSuffix).state)
+	ast.NotNil(asyncer.Get("a"))
+
+	// deleted content is not served from the last good copy
+	remote.MockAsyncer.Set("b", nil)
+	ast.Nil(asyncer.Get("b"))
+	ast.False(asyncer.Stale("b"))
+	remote.MockAsyncer.Set("b", []byte(`{"b":1}`))
+
+	// failures of one key do not open the circuit of other keys
+	atomic.StoreInt32(&remote.down, 1)
+	ast.NotNil(asyncer.Get("a"))
+	ast.Equal(circuitOpen, asyncer.breaker("a").state)
+	atomic.StoreInt32(&remote.down, 0)
+	ast.NotNil(asyncer.Get("b"))
+	ast.Equal(circuitClosed, asyncer.breaker("b").state)
+	ast.True(asyncer.Stale("a"))
+	ast.False(asyncer.Stale("b"))
+}
+
+func TestResilientAsyncerCallerContext(t *testing.T) {
+	ast := assert.New(t)
+
+	key := "resilient_ctx_key"
+	remote := &flakyAsyncer{MockAsyncer: NewMockAsyncer(false), delay: 20 * time.Millisecond}
+	remote.MockAsyncer.Set(key, []byte(`{"a":1}`))
+
+	asyncer := NewResilientAsyncer(remote, &ResilientOptions{
+		Timeout:          time.Second,
+		MinBackoff:       time.Minute,
+		FailureThreshold: 1,
+	})
+	v2 := asyncer.V2()
+
+	// canceled by the caller before the call, remote is not called
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := v2.Get(ctx, key)
+	ast.Equal(context.Canceled, err)
+	ast.EqualValues(0, atomic.LoadInt32(&remote.calls))
+
+	// caller deadline is not counted as a failure
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Millisecond)
+	defer cancel()
+	_, _, err = v2.Get(ctx, key)
+	ast.Equal(context.DeadlineExceeded, err)
+	ast.Equal(circuitClosed, asyncer.breaker(key).state)
+	ast.Equal(0, asyncer.breaker(key).failures)
+	ast.False(asyncer.Stale(key))
+
+	// no backoff, the next call reaches the remote
+	content, _, err := v2.Get(context.Background(), key)
+	ast.Nil(err)
+	ast.NotNil(content)
+	ast.False(asyncer.Stale(key))
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrVersionConflict Set时配置内容的版本与ifVersion不一致
+	ErrVersionConflict = errors.New("config version conflict")
+)
+
+// Version 配置内容的版本，由AsyncerV2定义（如内容摘要、修改时间、数据库版本号）
+// 空字符串表示版本未知
+type Version string
+
+// contentVersion 以内容的md5作为版本
+func contentVersion(content []byte) Version {
+	if len(content) == 0 {
+		return ""
+	}
+
+	return Version(fmt.Sprintf("%x", md5.Sum(content)))
+}
+
+// AsyncerV2 支持context、错误及版本的异步配置接口
+//
+// Get: 内容不存在或为空时返回ErrEmptyContent，其它错误（网络、超时等）原样返回
+// Set: ifVersion不为空时，仅当当前内容的版本与ifVersion一致时写入，否则返回ErrVersionConflict
+type AsyncerV2 interface {
+	ContentType(key string) ContentType
+	Get(ctx context.Context, key string) ([]byte, Version, error)
+	Set(ctx context.Context, key string, value []byte, ifVersion Version) error
+	Watch(key string) chan struct{} // 实时监控配置变化
+}
+
+// unwatcher 由支持取消监听的Asyncer实现，Watch每次调用返回独立的channel，Unwatch后ch被关闭
+type unwatcher interface {
+	Unwatch(key string, ch chan struct{})
+}
+
+// notifyAll 通知所有监听者，已有未处理通知的跳过
+func notifyAll(chs []chan struct{}) {
+	for _, ch := range chs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// removeNotifyChan 从chs中移除ch，返回新的列表（不修改chs）及ch是否存在
+func removeNotifyChan(chs []chan struct{}, ch chan struct{}) ([]chan struct{}, bool) {
+	for i, item := range chs {
+		if item == ch {
+			ret := make([]chan struct{}, 0, len(chs)-1)
+			return append(append(ret, chs[:i]...), chs[i+1:]...), true
+		}
+	}
+
+	return chs, false
+}
+
+// asyncerV2Provider 由原生支持AsyncerV2的Asyncer实现
+type asyncerV2Provider interface {
+	V2() AsyncerV2
+}
+
+// asyncerWrapper 由包装其它Asyncer的装饰器实现（如CachedAsyncer、ResilientAsyncer）
+type asyncerWrapper interface {
+	Unwrap() Asyncer
+}
+
+// baseAsyncer 返回去掉所有装饰器后的Asyncer
+func baseAsyncer(a Asyncer) Asyncer {
+	for {
+		w, ok := a.(asyncerWrapper)
+		if !ok {
+			return a
+		}
+		a = w.Unwrap()
+	}
+}
+
+// reportsEmpty 返回Asyncer能否区分内容为空与获取失败
+// 只有原生支持AsyncerV2的Asyncer能够区分，适配的Asyncer获取失败时同样返回ErrEmptyContent
+func reportsEmpty(a Asyncer) bool {
+	_, ok := baseAsyncer(a).(asyncerV2Provider)
+	return ok
+}
+
+// AdaptAsyncer 将Asyncer转换为AsyncerV2
+//
+// 原生支持的Asyncer（如RedisAsyncer）返回其V2实现，
+// 否则通过适配器转换：以内容md5作为版本，空内容返回ErrEmptyContent，
+// Get在ctx结束时返回（原调用在后台完成），Set的版本检查不是原子的
+func AdaptAsyncer(a Asyncer) AsyncerV2 {
+	if p, ok := a.(asyncerV2Provider); ok {
+		return p.V2()
+	}
+
+	return &asyncerAdapter{
+		Asyncer: a,
+	}
+}
+
+type asyncerAdapter struct {
+	Asyncer
+}
+
+func (a *asyncerAdapter) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	ch := make(chan []byte, 1)
+	go func() {
+		ch <- a.Asyncer.Get(key)
+	}()
+
+	select {
+	case content := <-ch:
+		if len(content) == 0 {
+			return nil, "", ErrEmptyContent
+		}
+		return content, contentVersion(content), nil
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+func (a *asyncerAdapter) Set(ctx context.Context, key string, value []byte, ifVersion Version) error {
+	if ifVersion != "" {
+		_, version, err := a.Get(ctx, key)
+		if err != nil && err != ErrEmptyContent {
+			return err
+		}
+		if version != ifVersion {
+			return ErrVersionConflict
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.Asyncer.Set(key, value)
+}
+
+// Stale 转发至被适配的Asyncer
+func (a *asyncerAdapter) Stale(key string) bool {
+	if s, ok := a.Asyncer.(staler); ok {
+		return s.Stale(key)
+	}
+
+	return false
+}
+
+// Accept 转发至被适配的Asyncer
+func (a *asyncerAdapter) Accept(key string, version Version) {
+	if acc, ok := a.Asyncer.(accepter); ok {
+		acc.Accept(key, version)
+	}
+}
+
+// Unwatch 转发至被适配的Asyncer
+func (a *asyncerAdapter) Unwatch(key string, ch chan struct{}) {
+	if u, ok := a.Asyncer.(unwatcher); ok {
+		u.Unwatch(key, ch)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowAsyncer struct {
+	mu    sync.Mutex
+	data  map[string][]byte
+	delay time.Duration
+}
+
+func (a *slowAsyncer) ContentType(key string) ContentType {
+	return T_JSON
+}
+
+func (a *slowAsyncer) Get(key string) []byte {
+	a.mu.Lock()
+	delay, content := a.delay, a.data[key]
+	a.mu.Unlock()
+	time.Sleep(delay)
+	return content
+}
+
+func (a *slowAsyncer) Set(key string, value []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.data[key] = value
+	return nil
+}
+
+func (a *slowAsyncer) Watch(key string) chan struct{} {
+	return nil
+}
+
+func (a *slowAsyncer) setDelay(delay time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.delay = delay
+}
+
+func TestAdaptAsyncer(t *testing.T) {
+	ast := assert.New(t)
+
+	key := "v2_key"
+	remote := &slowAsyncer{data: map[string][]byte{}}
+	asyncer := AdaptAsyncer(remote)
+	ctx := context.Background()
+
+	_, _, err := asyncer.Get(ctx, key)
+	ast.Equal(ErrEmptyContent, err)
+
+	ast.Nil(asyncer.Set(ctx, key, []byte(`{"a":1}`), ""))
+	content, version, err := asyncer.Get(ctx, key)
+	ast.Nil(err)
+	ast.Equal(`{"a":1}`, string(content))
+	ast.Equal(ErrVersionConflict, asyncer.Set(ctx, key, []byte(`{"a":2}`), "bad_version"))
+	ast.Nil(asyncer.Set(ctx, key, []byte(`{"a":2}`), version))
+
+	// deadline
+	remote.setDelay(50 * time.Millisecond)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, _, err = asyncer.Get(timeoutCtx, key)
+	ast.Equal(context.DeadlineExceeded, err)
+
+	// async config records the error and keeps the last value
+	remote.setDelay(0)
+	cfg := NewAsyncConfig(remote, key, time.Millisecond, false, WithFetchTimeout(10*time.Millisecond))
+	ast.EqualValues(2, cfg.Get("a"))
+	status := cfg.Status()
+	ast.Equal(contentVersion([]byte(`{"a":2}`)), status.Version)
+	ast.Nil(status.LastError)
+
+	remote.setDelay(50 * time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(2, cfg.Get("a"))
+	status = cfg.Status()
+	ast.Equal(context.DeadlineExceeded, status.LastError)
+	ast.True(status.Ready)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/techxmind/config"
+)
+
+// cryptFunc 处理keyPath处的字符串值，返回新值及是否修改
+type cryptFunc func(keyPath string, value string) (string, bool, error)
+
+func runEncrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keys := fs.String("keys", "", "keyring, env:NAME or file:PATH")
+	write := fs.Bool("w", false, "write result to file instead of stdout")
+	fs.Parse(args)
+
+	if *keys == "" || fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	p, err := config.NewKeyProvider(*keys)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool)
+	for _, keyPath := range fs.Args()[1:] {
+		paths[keyPath] = false
+	}
+
+	err = cryptFile(fs.Arg(0), *write, func(keyPath string, value string) (string, bool, error) {
+		if _, ok := paths[keyPath]; !ok {
+			return value, false, nil
+		}
+		paths[keyPath] = true
+		if config.IsEncrypted(value) {
+			return value, false, nil
+		}
+		encrypted, err := config.EncryptValue(p, value)
+		return encrypted, err == nil, err
+	}, func() error {
+		var missing []string
+		for keyPath, found := range paths {
+			if !found {
+				missing = append(missing, keyPath)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf("string value not found at %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+
+	return err
+}
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keys := fs.String("keys", "", "keyring, env:NAME or file:PATH")
+	write := fs.Bool("w", false, "write result to file instead of stdout")
+	fs.Parse(args)
+
+	if *keys == "" || fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	p, err := config.NewKeyProvider(*keys)
+	if err != nil {
+		return err
+	}
+
+	// 未指定keyPath时解密所有加密的值
+	var paths map[string]bool
+	if fs.NArg() > 1 {
+		paths = make(map[string]bool)
+		for _, keyPath := range fs.Args()[1:] {
+			paths[keyPath] = true
+		}
+	}
+
+	return cryptFile(fs.Arg(0), *write, func(keyPath string, value string) (string, bool, error) {
+		if (paths != nil && !paths[keyPath]) || !config.IsEncrypted(value) {
+			return value, false, nil
+		}
+		decrypted, err := config.DecryptValue(p, value)
+		if err != nil {
+			return "", false, fmt.Errorf("path[%s]: %v", keyPath, err)
+		}
+		return decrypted, true, nil
+	}, nil)
+}
+
+// cryptFile 处理文件中的字符串值
+// YAML文件保留注释及顺序；JSON文件重新格式化（键按字母排序，注释被移除）
+func cryptFile(file string, write bool, fn cryptFunc, check func() error) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	if contentType(file) == config.T_YAML {
+		out, err = cryptYAML(content, fn)
+	} else {
+		out, err = cryptJSON(content, fn)
+	}
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	if !write {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, out, info.Mode())
+}
+
+func cryptYAML(content []byte, fn cryptFunc) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(content, &node); err != nil {
+		return nil, err
+	}
+
+	var walk func(keyPath string, n *yaml.Node) error
+	walk = func(keyPath string, n *yaml.Node) error {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, child := range n.Content {
+				if err := walk(keyPath, child); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if err := walk(joinKeyPath(keyPath, n.Content[i].Value), n.Content[i+1]); err != nil {
+					return err
+				}
+			}
+		case yaml.SequenceNode:
+			for i, child := range n.Content {
+				if err := walk(joinKeyPath(keyPath, strconv.Itoa(i)), child); err != nil {
+					return err
+				}
+			}
+		case yaml.ScalarNode:
+			if n.ShortTag() != "!!str" {
+				return nil
+			}
+			value, changed, err := fn(keyPath, n.Value)
+			if err != nil {
+				return err
+			}
+			if changed {
+				n.Value, n.Tag, n.Style = value, "!!str", 0
+			}
+		}
+		return nil
+	}
+	if err := walk(config.RootKey, &node); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func cryptJSON(content []byte, fn cryptFunc) ([]byte, error) {
+	tree, err := config.ParseContent(content, config.T_JSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var walk func(keyPath string, val interface{}) (interface{}, error)
+	walk = func(keyPath string, val interface{}) (interface{}, error) {
+		switch v := val.(type) {
+		case string:
+			value, _, err := fn(keyPath, v)
+			return value, err
+		case map[string]interface{}:
+			for k, item := range v {
+				newItem, err := walk(joinKeyPath(keyPath, k), item)
+				if err != nil {
+					return nil, err
+				}
+				v[k] = newItem
+			}
+		case []interface{}:
+			for i, item := range v {
+				newItem, err := walk(joinKeyPath(keyPath, strconv.Itoa(i)), item)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = newItem
+			}
+		}
+		return val, nil
+	}
+	if tree, err = walk(config.RootKey, tree); err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+func joinKeyPath(prefix string, key string) string {
+	if prefix == config.RootKey {
+		return key
+	}
+
+	return prefix + "." + key
+}
@@ -0,0 +1,139 @@
+// configctl 配置文件的命令行工具，用于在CI中推送配置前检查、签名配置文件，以及加解密配置文件中的值
+//
+//	configctl validate -schema schema.json [-key keyPath] file...
+//	configctl encrypt -keys env:CONFIG_KEYS [-w] file keyPath...
+//	configctl decrypt -keys env:CONFIG_KEYS [-w] file [keyPath...]
+//	configctl sign -key env:CONFIG_SIGNING_KEY -name app_config [-seq N] [-w|-detached] file
+//	configctl keygen keyID
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/techxmind/config"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "validate",
+		usage: "validate -schema schema.json [-key keyPath] file...",
+		run:   runValidate,
+	},
+	{
+		name:  "encrypt",
+		usage: "encrypt -keys env:NAME|file:PATH [-w] file keyPath...",
+		run:   runEncrypt,
+	},
+	{
+		name:  "decrypt",
+		usage: "decrypt -keys env:NAME|file:PATH [-w] file [keyPath...]",
+		run:   runDecrypt,
+	},
+	{
+		name:  "sign",
+		usage: "sign -key env:NAME|file:PATH -name configKey [-seq N] [-w|-detached] file",
+		run:   runSign,
+	},
+	{
+		name:  "keygen",
+		usage: "keygen keyID",
+		run:   runKeygen,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  configctl %s\n", cmd.usage)
+	}
+	os.Exit(2)
+}
+
+// contentType 与FileAsyncer的规则一致
+func contentType(file string) config.ContentType {
+	return config.NewFileAsyncer().ContentType(file)
+}
+
+func readTree(file string) (interface{}, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.ParseContent(content, contentType(file))
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	schemaFile := fs.String("schema", "", "JSON Schema file (.json or .yml)")
+	keyPath := fs.String("key", config.RootKey, "validate the node at key path instead of the whole file")
+	fs.Parse(args)
+
+	if *schemaFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	content, err := ioutil.ReadFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := config.ParseSchema(content, contentType(*schemaFile))
+	if err != nil {
+		return err
+	}
+	validator := config.SchemaValidator(schema, *keyPath)
+
+	failed := 0
+	for _, file := range fs.Args() {
+		tree, err := readTree(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed++
+			continue
+		}
+
+		if err := validator(tree, nil); err != nil {
+			for _, e := range config.SchemaErrors(err) {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, e)
+			}
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s: ok\n", file)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files invalid", failed, fs.NArg())
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/techxmind/config"
+)
+
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	key := fs.String("key", "", "signing key, env:NAME or file:PATH with an id:base64key entry")
+	name := fs.String("name", "", "config key the content is pushed to, the signature is only valid for this key")
+	seq := fs.Uint64("seq", 0, "increasing sequence number of the signature, defaults to the current unix time")
+	write := fs.Bool("w", false, "write result to file instead of stdout")
+	detached := fs.Bool("detached", false, "write the signature to file"+config.SignatureSuffix+" instead of the first line")
+	fs.Parse(args)
+
+	if *key == "" || *name == "" || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	kid, priv, err := config.LoadSigningKey(*key)
+	if err != nil {
+		return err
+	}
+
+	// 序号小于已接受的序号的签名会被拒绝，默认使用时间戳保证递增
+	if *seq == 0 {
+		*seq = uint64(time.Now().Unix())
+	}
+
+	file := fs.Arg(0)
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if *detached {
+		return ioutil.WriteFile(file+config.SignatureSuffix, config.DetachedSignature(priv, kid, *name, *seq, content), 0644)
+	}
+
+	out := config.SignContent(priv, kid, *name, *seq, content, contentType(file))
+	if !*write {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, out, info.Mode())
+}
+
+// runKeygen 生成签名密钥对，私钥用于sign，公钥用于conf.trusted_keys
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	kid := fs.Arg(0)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	enc := base64.StdEncoding
+	fmt.Printf("# private key, keep it secret\n%s:%s\n", kid, enc.EncodeToString(priv.Seed()))
+	fmt.Printf("# public key\n%s:%s\n", kid, enc.EncodeToString(pub))
+
+	return nil
+}
@@ -1,29 +1,43 @@
 package config
 
+import (
+	"context"
+)
+
 type Configer interface {
 	Get(keyPath string) interface{}
 	Set(keyPath string, value interface{}) error
-	Watch(notifier chan struct{})
+	Watch(notifier chan struct{}) Subscription
 }
 
 type Config interface {
 	Configer
 	Exist(keyPath string) bool
 	JSON(keyPath string) ([]byte, error)
+	JSONRedacted(keyPath string) ([]byte, error)
 	Remarshal(keyPath string, v interface{}) error
 	Dump(keyPath string)
 	Map(keyPath string) *MapConfig
 	Merge(value interface{}) error
+	WatchContext(ctx context.Context, notifier chan struct{}) Subscription
+	WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription
+	WatchKeyContext(ctx context.Context, keyPath string, fn func(ev ChangeEvent)) Subscription
 	String(keyPath string) string
+	StringE(keyPath string) (string, error)
 	StringDefault(keyPath string, dft string) (value string)
 	Bytes(keyPath string) []byte
+	BytesE(keyPath string) ([]byte, error)
 	BytesDefault(keyPath string, dft []byte) (value []byte)
 	Float(keyPath string) float64
+	FloatE(keyPath string) (float64, error)
 	FloatDefault(keyPath string, dft float64) float64
 	Int(keyPath string) int64
+	IntE(keyPath string) (int64, error)
 	IntDefault(keyPath string, dft int64) int64
 	Uint(keyPath string) uint64
+	UintE(keyPath string) (uint64, error)
 	UintDefault(keyPath string, dft uint64) uint64
 	Bool(keyPath string) bool
+	BoolE(keyPath string) (bool, error)
 	BoolDefault(keyPath string, dft bool) bool
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/pkg/errors"
@@ -12,6 +13,20 @@ type ConfigHelper struct {
 	Configer
 }
 
+// layerLookuper 由多层配置实现，用于在错误信息中报告配置值来源的层
+type layerLookuper interface {
+	lookup(keyPath string) (val interface{}, layerName string)
+}
+
+// lookup 返回指定节点的配置值及其来源层
+func (h *ConfigHelper) lookup(keyPath string) (interface{}, string) {
+	if l, ok := h.Configer.(layerLookuper); ok {
+		return l.lookup(keyPath)
+	}
+
+	return h.Get(keyPath), ""
+}
+
 // Exist 返回指定节点是否存在配置
 func (h *ConfigHelper) Exist(keyPath string) bool {
 	return h.Get(keyPath) != nil
@@ -28,6 +43,17 @@ func (h *ConfigHelper) JSON(keyPath string) ([]byte, error) {
 	return json.Marshal(val)
 }
 
+// JSONRedacted 同JSON，敏感值（见IsSecret、Redact）被替换为RedactMask
+func (h *ConfigHelper) JSONRedacted(keyPath string) ([]byte, error) {
+	val := h.Get(keyPath)
+
+	if val == nil {
+		return nil, errors.Errorf("path[%s] is nil", keyPath)
+	}
+
+	return json.Marshal(Redact(keyPath, val))
+}
+
 // Remarshal 指定配置重新unmarshal为v
 func (h *ConfigHelper) Remarshal(keyPath string, v interface{}) error {
 	bs, err := h.JSON(keyPath)
@@ -39,9 +65,9 @@ func (h *ConfigHelper) Remarshal(keyPath string, v interface{}) error {
 	return json.Unmarshal(bs, v)
 }
 
-// Dump 打印指定节点的配置JSON
+// Dump 打印指定节点的配置JSON，敏感值被替换为RedactMask
 func (h *ConfigHelper) Dump(keyPath string) {
-	PrintJSON(h.Get(keyPath))
+	PrintJSON(Redact(keyPath, h.Get(keyPath)))
 }
 
 // Map 返回子配置
@@ -63,6 +89,25 @@ func (h *ConfigHelper) Map(keyPath string) *MapConfig {
 	return nil
 }
 
+// WatchKey 监听指定节点的变化，仅当该节点（含子节点）的值发生变化时回调
+//
+//	cfg.WatchKey("db", func(ev ChangeEvent) {
+//		// ev.OldValue, ev.NewValue, ev.ChangedPaths
+//	})
+func (h *ConfigHelper) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return watchKey(h.Configer, keyPath, fn)
+}
+
+// WatchContext 同Watch，ctx结束时自动取消订阅
+func (h *ConfigHelper) WatchContext(ctx context.Context, notifier chan struct{}) Subscription {
+	return bindContext(ctx, h.Watch(notifier))
+}
+
+// WatchKeyContext 同WatchKey，ctx结束时自动取消订阅
+func (h *ConfigHelper) WatchKeyContext(ctx context.Context, keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return bindContext(ctx, h.WatchKey(keyPath, fn))
+}
+
 // Merge 合并配置
 //
 // alias to Set(RootKey ...)
@@ -76,15 +121,19 @@ func (h *ConfigHelper) String(keyPath string) string {
 	return itype.String(h.Get(keyPath))
 }
 
+// StringE 返回指定节点string类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) StringE(keyPath string) (string, error) {
+	return ValueE[string](h, keyPath)
+}
+
 // StringDefault 返回指定节点string类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) StringDefault(keyPath string, dft string) (value string) {
-	value = h.String(keyPath)
-
-	if value == "" {
-		value = dft
+	ivalue := h.Get(keyPath)
+	if ivalue == nil {
+		return dft
 	}
 
-	return
+	return itype.String(ivalue)
 }
 
 // Bytes 返回指定节点[]byte类型的配置值
@@ -92,13 +141,19 @@ func (h *ConfigHelper) Bytes(keyPath string) []byte {
 	return itype.Bytes(h.Get(keyPath))
 }
 
+// BytesE 返回指定节点[]byte类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) BytesE(keyPath string) ([]byte, error) {
+	return ValueE[[]byte](h, keyPath)
+}
+
 // BytesDefault 返回指定节点[]byte类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) BytesDefault(keyPath string, dft []byte) (value []byte) {
-	if value = h.Bytes(keyPath); len(value) == 0 {
-		value = dft
+	ivalue := h.Get(keyPath)
+	if ivalue == nil {
+		return dft
 	}
 
-	return
+	return itype.Bytes(ivalue)
 }
 
 // Float 返回指定节点float64类型的配置值
@@ -107,6 +162,11 @@ func (h *ConfigHelper) Float(keyPath string) float64 {
 	return itype.Float(h.Get(keyPath))
 }
 
+// FloatE 返回指定节点float64类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) FloatE(keyPath string) (float64, error) {
+	return ValueE[float64](h, keyPath)
+}
+
 // FloatDefault 返回指定节点float64类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) FloatDefault(keyPath string, dft float64) float64 {
 	ivalue := h.Get(keyPath)
@@ -123,6 +183,11 @@ func (h *ConfigHelper) Int(keyPath string) int64 {
 	return itype.Int(h.Get(keyPath))
 }
 
+// IntE 返回指定节点int64类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) IntE(keyPath string) (int64, error) {
+	return ValueE[int64](h, keyPath)
+}
+
 // IntDefault 返回指定节点int64类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) IntDefault(keyPath string, dft int64) int64 {
 	ivalue := h.Get(keyPath)
@@ -139,6 +204,11 @@ func (h *ConfigHelper) Uint(keyPath string) uint64 {
 	return itype.Uint(h.Get(keyPath))
 }
 
+// UintE 返回指定节点uint64类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) UintE(keyPath string) (uint64, error) {
+	return ValueE[uint64](h, keyPath)
+}
+
 // UintDefault 返回指定节点uint64类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) UintDefault(keyPath string, dft uint64) uint64 {
 	ivalue := h.Get(keyPath)
@@ -156,6 +226,11 @@ func (h *ConfigHelper) Bool(keyPath string) bool {
 	return !isFalseStr(str)
 }
 
+// BoolE 返回指定节点bool类型的配置值，节点不存在或类型不匹配时返回错误
+func (h *ConfigHelper) BoolE(keyPath string) (bool, error) {
+	return ValueE[bool](h, keyPath)
+}
+
 // BoolDefault 返回指定节点bool类型的配置值，不存在则返回默认值
 func (h *ConfigHelper) BoolDefault(keyPath string, dft bool) bool {
 	ivalue := h.Get(keyPath)
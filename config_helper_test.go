@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigHelperE(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := NewMapConfig(map[string]interface{}{
+		"int":       14,
+		"int_str":   "15",
+		"bad_int":   "abc",
+		"neg":       -1,
+		"float":     0.12,
+		"empty_str": "",
+		"bool":      false,
+		"bool_str":  "On",
+		"bool_num":  1,
+		"half":      1.5,
+		"map": map[string]interface{}{
+			"k": "v",
+		},
+	})
+
+	i, err := cfg.IntE("int")
+	ast.Nil(err)
+	ast.Equal(int64(14), i)
+
+	i, err = cfg.IntE("int_str")
+	ast.Nil(err)
+	ast.Equal(int64(15), i)
+
+	_, err = cfg.IntE("not_exist")
+	ast.True(errors.Is(err, ErrKeyNotFound))
+
+	_, err = cfg.IntE("bad_int")
+	var typeErr *TypeError
+	ast.True(errors.As(err, &typeErr))
+	ast.Equal("bad_int", typeErr.KeyPath)
+	ast.Equal("int64", typeErr.Want)
+
+	_, err = cfg.UintE("neg")
+	ast.True(errors.As(err, &typeErr))
+
+	f, err := cfg.FloatE("float")
+	ast.Nil(err)
+	ast.InDelta(0.12, f, 0.000001)
+
+	s, err := cfg.StringE("empty_str")
+	ast.Nil(err)
+	ast.Equal("", s)
+
+	_, err = cfg.StringE("map")
+	ast.True(errors.As(err, &typeErr))
+
+	b, err := cfg.BoolE("bool")
+	ast.Nil(err)
+	ast.False(b)
+
+	b, err = cfg.BoolE("bool_str")
+	ast.Nil(err)
+	ast.True(b)
+
+	b, err = cfg.BoolE("bool_num")
+	ast.Nil(err)
+	ast.True(b)
+
+	for _, key := range []string{"bad_int", "int", "half", "map"} {
+		_, err = cfg.BoolE(key)
+		ast.True(errors.As(err, &typeErr), key)
+	}
+
+	// lossy conversions are type errors
+	_, err = cfg.IntE("half")
+	ast.True(errors.As(err, &typeErr))
+	_, err = cfg.UintE("half")
+	ast.True(errors.As(err, &typeErr))
+	i, err = cfg.IntE("bool_num")
+	ast.Nil(err)
+	ast.Equal(int64(1), i)
+
+	bs, err := cfg.BytesE("map.k")
+	ast.Nil(err)
+	ast.Equal([]byte("v"), bs)
+
+	// Default variants fall back only when the key is absent
+	ast.Equal("", cfg.StringDefault("empty_str", "dft"))
+	ast.Equal("dft", cfg.StringDefault("not_exist", "dft"))
+	ast.Equal([]byte{}, cfg.BytesDefault("empty_str", []byte("dft")))
+	ast.Equal(int64(0), cfg.IntDefault("bad_int", 6))
+}
+
+func TestTypeErrorLayer(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	cfg.AddLayer(DefaultLayerName, NewMapConfig(nil))
+	cfg.AddLayer("custom", NewMapConfig(map[string]interface{}{
+		"port": "abc",
+	}))
+
+	_, err := cfg.Layer("custom").IntE("port")
+	var typeErr *TypeError
+	ast.True(errors.As(err, &typeErr))
+	ast.Equal("custom", typeErr.Layer)
+
+	_, err = cfg.IntE("port")
+	ast.True(errors.Is(err, ErrKeyNotFound))
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+)
+
+type layersContextKey struct{}
+
+// WithLayers 返回附加了Layer的Context，使用Context的查询（如StringCtx、FromContext）会优先在这些Layer中查找，
+// 之后再查找默认Layer。多次调用时，后附加的Layer优先级更高
+// 注意：ctx中已有快照（WithSnapshot）时查询使用快照，应先附加Layer再创建快照
+//
+//	ctx = config.WithLayers(ctx, "tenant-42", "region-eu")
+//	config.StringCtx(ctx, "db.host") // 依次从tenant-42、region-eu及默认Layer中查找
+func WithLayers(ctx context.Context, layerNames ...string) context.Context {
+	if len(layerNames) == 0 {
+		return ctx
+	}
+
+	origins := LayersFromContext(ctx)
+	names := make([]string, 0, len(layerNames)+len(origins))
+	names = append(names, layerNames...)
+	names = append(names, origins...)
+
+	return context.WithValue(ctx, layersContextKey{}, names)
+}
+
+// LayersFromContext 返回WithLayers附加的Layer
+func LayersFromContext(ctx context.Context) []string {
+	names, _ := ctx.Value(layersContextKey{}).([]string)
+
+	return names
+}
+
+// searchLayerNames 返回ctx的Layer查找路径，ctx未附加Layer时返回nil（即默认Layer）
+func (cfg *defaultConfig) searchLayerNames(ctx context.Context) []string {
+	ctxNames := LayersFromContext(ctx)
+	if len(ctxNames) == 0 {
+		return nil
+	}
+
+	defaultNames := cfg.defaultLayerNames.Load().([]string)
+	names := make([]string, 0, len(ctxNames)+len(defaultNames))
+	seen := make(map[string]bool, cap(names))
+	for _, list := range [][]string{ctxNames, defaultNames} {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// contextConfig 返回ctx对应的配置：ctx中有快照时返回快照，否则按ctx的Layer查找路径查询
+func contextConfig(ctx context.Context) (*ConfigHelper, func()) {
+	if s, ok := ctx.Value(snapshotContextKey{}).(*SnapshotConfig); ok {
+		return &s.ConfigHelper, func() {}
+	}
+
+	p := _cfg.Layer(_cfg.searchLayerNames(ctx)...)
+
+	return &p.ConfigHelper, func() {
+		_cfg.PutLayer(p)
+	}
+}
+
+func GetCtx(ctx context.Context, keyPath string) interface{} {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Get(keyPath)
+}
+
+func StringCtx(ctx context.Context, keyPath string) string {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.String(keyPath)
+}
+
+func StringECtx(ctx context.Context, keyPath string) (string, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.StringE(keyPath)
+}
+
+func StringDefaultCtx(ctx context.Context, keyPath string, dft string) string {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.StringDefault(keyPath, dft)
+}
+
+func BytesCtx(ctx context.Context, keyPath string) []byte {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Bytes(keyPath)
+}
+
+func BytesECtx(ctx context.Context, keyPath string) ([]byte, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.BytesE(keyPath)
+}
+
+func BytesDefaultCtx(ctx context.Context, keyPath string, dft []byte) []byte {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.BytesDefault(keyPath, dft)
+}
+
+func FloatCtx(ctx context.Context, keyPath string) float64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Float(keyPath)
+}
+
+func FloatECtx(ctx context.Context, keyPath string) (float64, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.FloatE(keyPath)
+}
+
+func FloatDefaultCtx(ctx context.Context, keyPath string, dft float64) float64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.FloatDefault(keyPath, dft)
+}
+
+func IntCtx(ctx context.Context, keyPath string) int64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Int(keyPath)
+}
+
+func IntECtx(ctx context.Context, keyPath string) (int64, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.IntE(keyPath)
+}
+
+func IntDefaultCtx(ctx context.Context, keyPath string, dft int64) int64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.IntDefault(keyPath, dft)
+}
+
+func UintCtx(ctx context.Context, keyPath string) uint64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Uint(keyPath)
+}
+
+func UintECtx(ctx context.Context, keyPath string) (uint64, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.UintE(keyPath)
+}
+
+func UintDefaultCtx(ctx context.Context, keyPath string, dft uint64) uint64 {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.UintDefault(keyPath, dft)
+}
+
+func BoolCtx(ctx context.Context, keyPath string) bool {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.Bool(keyPath)
+}
+
+func BoolECtx(ctx context.Context, keyPath string) (bool, error) {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.BoolE(keyPath)
+}
+
+func BoolDefaultCtx(ctx context.Context, keyPath string, dft bool) bool {
+	c, release := contextConfig(ctx)
+	defer release()
+	return c.BoolDefault(keyPath, dft)
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLayers(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Nil(Set("ctx_layers", map[string]interface{}{
+		"host":  "default.example.com",
+		"port":  80,
+		"debug": false,
+	}))
+	AddLayer("tenant-42", NewMapConfig(map[string]interface{}{
+		"ctx_layers": map[string]interface{}{"host": "tenant.example.com"},
+	}))
+	AddLayer("region-eu", NewMapConfig(map[string]interface{}{
+		"ctx_layers": map[string]interface{}{"host": "eu.example.com", "port": "8080"},
+	}))
+	defer RemoveLayer("tenant-42")
+	defer RemoveLayer("region-eu")
+
+	ctx := context.Background()
+	ast.Equal("default.example.com", StringCtx(ctx, "ctx_layers.host"))
+
+	ctx = WithLayers(ctx, "region-eu")
+	ctx = WithLayers(ctx, "tenant-42")
+	ast.Equal([]string{"tenant-42", "region-eu"}, LayersFromContext(ctx))
+	ast.Equal("tenant.example.com", StringCtx(ctx, "ctx_layers.host"))
+	ast.EqualValues(8080, IntCtx(ctx, "ctx_layers.port"))
+	ast.False(BoolDefaultCtx(ctx, "ctx_layers.debug", true))
+	ast.Equal("x", StringDefaultCtx(ctx, "ctx_layers.missing", "x"))
+
+	_, err := BoolECtx(ctx, "ctx_layers.missing")
+	ast.True(isKeyNotFound(err))
+
+	// snapshot keeps the context layers
+	sctx := WithSnapshot(ctx)
+	Set("ctx_layers.debug", true)
+	ast.False(BoolCtx(sctx, "ctx_layers.debug"))
+	ast.True(BoolCtx(ctx, "ctx_layers.debug"))
+	ast.Equal("tenant.example.com", FromContext(sctx).String("ctx_layers.host"))
+	ast.Equal("tenant.example.com", FromContext(ctx).String("ctx_layers.host"))
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/techxmind/go-utils/itype"
+)
+
+// 严格类型转换，规则与itype一致，但无法转换（含有损转换，如1.5转为整数）时返回false，而不是静默返回零值
+
+// boolStrings 可转换为bool的字符串（不区分大小写）
+var boolStrings = map[string]bool{
+	"1": true, "true": true, "t": true, "on": true, "yes": true, "y": true,
+	"": false, "0": false, "false": false, "f": false, "off": false, "no": false, "n": false,
+}
+
+func isScalar(v interface{}) bool {
+	switch itype.GetType(v) {
+	case itype.STRING, itype.NUMBER, itype.BOOL:
+		return true
+	}
+
+	switch v.(type) {
+	case json.Number, []byte:
+		return true
+	}
+
+	return false
+}
+
+func toString(v interface{}) (string, bool) {
+	if !isScalar(v) {
+		return "", false
+	}
+
+	if n, ok := v.(json.Number); ok {
+		return n.String(), true
+	}
+
+	return itype.String(v), true
+}
+
+func toBytes(v interface{}) ([]byte, bool) {
+	s, ok := toString(v)
+	if !ok {
+		return nil, false
+	}
+
+	return []byte(s), true
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch vv := v.(type) {
+	case string:
+		n, err := strconv.ParseInt(vv, 10, 64)
+		return n, err == nil
+	case json.Number:
+		if n, err := vv.Int64(); err == nil {
+			return n, true
+		}
+		f, err := vv.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return floatToInt(f)
+	case uint64:
+		return int64(vv), vv <= math.MaxInt64
+	case uint:
+		return int64(vv), uint64(vv) <= math.MaxInt64
+	case float64:
+		return floatToInt(vv)
+	case float32:
+		return floatToInt(float64(vv))
+	}
+
+	if !isScalar(v) {
+		return 0, false
+	}
+
+	return itype.Int(v), true
+}
+
+func toUint(v interface{}) (uint64, bool) {
+	switch vv := v.(type) {
+	case string:
+		n, err := strconv.ParseUint(vv, 10, 64)
+		return n, err == nil
+	case json.Number:
+		if n, err := strconv.ParseUint(vv.String(), 10, 64); err == nil {
+			return n, true
+		}
+		f, err := vv.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return floatToUint(f)
+	case float64:
+		return floatToUint(vv)
+	case float32:
+		return floatToUint(float64(vv))
+	}
+
+	if !isScalar(v) || itype.Float(v) < 0 {
+		return 0, false
+	}
+
+	return itype.Uint(v), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case string:
+		n, err := strconv.ParseFloat(vv, 64)
+		return n, err == nil
+	case json.Number:
+		n, err := vv.Float64()
+		return n, err == nil
+	}
+
+	if !isScalar(v) {
+		return 0, false
+	}
+
+	return itype.Float(v), true
+}
+
+// toBool 只接受bool、数值0/1及可识别的字符串（见boolStrings）
+func toBool(v interface{}) (bool, bool) {
+	switch vv := v.(type) {
+	case bool:
+		return vv, true
+	case string:
+		b, ok := boolStrings[strings.ToLower(strings.TrimSpace(vv))]
+		return b, ok
+	case []byte:
+		b, ok := boolStrings[strings.ToLower(strings.TrimSpace(string(vv)))]
+		return b, ok
+	}
+
+	f, ok := toFloat(v)
+	if !ok || (f != 0 && f != 1) {
+		return false, false
+	}
+
+	return f == 1, true
+}
+
+// isIntegral 返回f是否为有限的整数值
+func isIntegral(f float64) bool {
+	return !math.IsInf(f, 0) && !math.IsNaN(f) && f == math.Trunc(f)
+}
+
+// floatToInt 转换为int64，非整数或超出int64范围时返回false
+func floatToInt(f float64) (int64, bool) {
+	// -2^63可精确表示，2^63超出范围
+	if !isIntegral(f) || f < math.MinInt64 || f >= -math.MinInt64 {
+		return 0, false
+	}
+
+	return int64(f), true
+}
+
+// floatToUint 转换为uint64，非整数、负数或超出uint64范围时返回false
+func floatToUint(f float64) (uint64, bool) {
+	if !isIntegral(f) || f < 0 || f >= 2*-math.MinInt64 {
+		return 0, false
+	}
+
+	return uint64(f), true
+}
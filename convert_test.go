@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToIntRange(t *testing.T) {
+	ast := assert.New(t)
+
+	tests := []struct {
+		v   interface{}
+		i   int64
+		iOk bool
+		u   uint64
+		uOk bool
+	}{
+		{float64(42), 42, true, 42, true},
+		{float64(-1), -1, true, 0, false},
+		{float64(-0.5), 0, false, 0, false},
+		{float64(1e19), 0, false, 1e19, true},
+		{float64(1e30), 0, false, 0, false},
+		{float64(-1e30), 0, false, 0, false},
+		{float64(math.MinInt64), math.MinInt64, true, 0, false},
+		{float64(1 << 63), 0, false, 1 << 63, true},
+		{float64(1 << 64), 0, false, 0, false},
+		{float32(1e30), 0, false, 0, false},
+		{float32(-2), -2, true, 0, false},
+		{json.Number("1e19"), 0, false, 1e19, true},
+		{json.Number("1e30"), 0, false, 0, false},
+		{json.Number("-1e2"), -100, true, 0, false},
+		{json.Number("9223372036854775807"), math.MaxInt64, true, math.MaxInt64, true},
+		{json.Number("18446744073709551615"), 0, false, math.MaxUint64, true},
+	}
+	for _, test := range tests {
+		i, ok := toInt(test.v)
+		ast.Equal(test.iOk, ok, "toInt(%T(%v))", test.v, test.v)
+		if ok {
+			ast.Equal(test.i, i, "toInt(%T(%v))", test.v, test.v)
+		}
+		u, ok := toUint(test.v)
+		ast.Equal(test.uOk, ok, "toUint(%T(%v))", test.v, test.v)
+		if ok {
+			ast.Equal(test.u, u, "toUint(%T(%v))", test.v, test.v)
+		}
+	}
+}
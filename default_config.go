@@ -1,10 +1,13 @@
 package config
 
 import (
+	"context"
+	"io"
 	"sync"
 	"sync/atomic"
 
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 )
 
 const (
@@ -27,6 +30,24 @@ type defaultConfig struct {
 	proxyPool         sync.Pool
 	defaultLayerNames atomic.Value //[]string
 	ConfigHelper
+
+	// 默认Layer的订阅，Layer变化时同步更新
+	subsMu      sync.Mutex
+	defaultSubs map[*layerSubscription]struct{}
+
+	// 由配置自身创建的Layer(Load/init)，RemoveLayer时关闭
+	ownedLayers sync.Map //[string]Configer
+	closed      int32
+
+	// Layer的配置校验，对之后添加的同名Layer同样生效
+	validatorsMu sync.Mutex
+	validators   map[string][]Validator
+
+	// 合并视图模式，见EnableMergedView
+	merged mergedView
+
+	// 配置值中的引用，见EnableInterpolation
+	interpolation interpolation
 }
 
 type defaultConfiger struct {
@@ -37,16 +58,26 @@ func (c *defaultConfiger) Get(keyPath string) interface{} {
 	return c.cfg.Get2(keyPath)
 }
 
+func (c *defaultConfiger) lookup(keyPath string) (interface{}, string) {
+	return c.cfg.lookup2(keyPath)
+}
+
 func (c *defaultConfiger) Set(keyPath string, value interface{}) error {
 	return c.cfg.Set2(keyPath, value)
 }
 
-func (c *defaultConfiger) Watch(notifier chan struct{}) {
-	c.cfg.Watch2(notifier)
+func (c *defaultConfiger) Watch(notifier chan struct{}) Subscription {
+	return c.cfg.Watch2(notifier)
+}
+
+func (c *defaultConfiger) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return c.cfg.WatchKey2(keyPath, fn)
 }
 
 func newConfig() *defaultConfig {
-	c := &defaultConfig{}
+	c := &defaultConfig{
+		defaultSubs: make(map[*layerSubscription]struct{}),
+	}
 	c.ConfigHelper = ConfigHelper{
 		Configer: &defaultConfiger{
 			cfg: c,
@@ -76,6 +107,8 @@ func (cfg *defaultConfig) AddDefaultLayerName(layerName string) {
 		}
 	}
 	cfg.defaultLayerNames.Store(s)
+	cfg.syncDefaultSubscriptions(layerName)
+	cfg.invalidateMergedView()
 }
 
 func AddDefaultLayerName(layerName string) {
@@ -91,21 +124,49 @@ func (cfg *defaultConfig) RemoveDefaultLayerName(layerName string) {
 		}
 	}
 	cfg.defaultLayerNames.Store(news)
+	cfg.syncDefaultSubscriptions(layerName)
+	cfg.invalidateMergedView()
 }
 
 func RemoveDefaultLayerName(layerName string) {
 	_cfg.RemoveDefaultLayerName(layerName)
 }
 
-func (cfg *defaultConfig) AddLayer(layerName string, layer Configer) {
+// AddLayer 添加或替换Layer，Layer当前内容未通过已注册的校验（见AddValidator）时返回错误，不添加该Layer
+func (cfg *defaultConfig) AddLayer(layerName string, layer Configer) error {
+	if origin, ok := cfg.layers.Load(layerName); !ok || origin != layer {
+		if err := cfg.applyValidators(layerName, layer); err != nil {
+			return err
+		}
+	}
+	cfg.storeLayer(layerName, layer)
+
+	return nil
+}
+
+func (cfg *defaultConfig) storeLayer(layerName string, layer Configer) {
 	cfg.layers.Store(layerName, layer)
+	cfg.syncDefaultSubscriptions(layerName)
+	cfg.syncMergedSubscriptions(layerName)
+	cfg.invalidateMergedView()
 }
 
-func AddLayer(layerName string, layer Configer) {
-	_cfg.AddLayer(layerName, layer)
+func AddLayer(layerName string, layer Configer) error {
+	return _cfg.AddLayer(layerName, layer)
+}
+
+// addOwnedLayer 添加由配置自身创建的Layer，RemoveLayer时会关闭该Layer
+// Load创建的Layer已添加了校验（见layerValidators），启动时创建的Layer在之后AddValidator时校验
+func (cfg *defaultConfig) addOwnedLayer(layerName string, layer Configer) {
+	cfg.ownedLayers.Store(layerName, layer)
+	cfg.storeLayer(layerName, layer)
 }
 
 func (cfg *defaultConfig) Load(path string, sources ...string) (Config, error) {
+	if cfg.isClosed() {
+		return nil, ErrClosed
+	}
+
 	if _, ok := cfg.layers.Load(path); !ok {
 		source := cfg.StringDefault(DefaultConfSourceKey, "redis")
 		if len(sources) > 0 {
@@ -113,8 +174,13 @@ func (cfg *defaultConfig) Load(path string, sources ...string) (Config, error) {
 		}
 		args := GetAsyncer(source)
 		if args != nil {
-			layer := NewAsyncConfig(args.Ins, path, args.CacheTime, args.RefreshAsync)
-			cfg.AddLayer(path, layer)
+			layer := NewAsyncConfig(
+				args.Ins, path, args.CacheTime, args.RefreshAsync,
+				WithRequired(args.Required),
+				WithValidator(cfg.layerValidators(path)...),
+				WithTrustedKeys(args.TrustedKeys),
+			)
+			cfg.addOwnedLayer(path, layer)
 		} else {
 			return nil, errors.Errorf("unsupport config source[%s], maybe config not inited?", source)
 		}
@@ -127,14 +193,72 @@ func Load(path string, remoteSources ...string) (Config, error) {
 	return _cfg.Load(path, remoteSources...)
 }
 
+// RemoveLayer 移除Layer，由Load创建的Layer同时会被关闭
 func (cfg *defaultConfig) RemoveLayer(layerName string) {
+	layer, ok := cfg.layers.Load(layerName)
 	cfg.layers.Delete(layerName)
+	cfg.syncDefaultSubscriptions(layerName)
+	cfg.syncMergedSubscriptions(layerName)
+	cfg.invalidateMergedView()
+
+	if owned, isOwned := cfg.ownedLayers.Load(layerName); isOwned && ok && owned == layer {
+		cfg.ownedLayers.Delete(layerName)
+		if closer, ok := layer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("close layer[%s] err:%v", layerName, err)
+			}
+		}
+	}
 }
 
 func RemoveLayer(layerName string) {
 	_cfg.RemoveLayer(layerName)
 }
 
+func (cfg *defaultConfig) isClosed() bool {
+	return atomic.LoadInt32(&cfg.closed) == 1
+}
+
+// Close 取消默认Layer的订阅并关闭由配置自身创建的Layer（Load及启动参数创建的），之后的Set/Load返回ErrClosed
+// 通过AddLayer添加的Layer由调用方负责关闭
+func (cfg *defaultConfig) Close() error {
+	if !atomic.CompareAndSwapInt32(&cfg.closed, 0, 1) {
+		return ErrClosed
+	}
+
+	for _, s := range cfg.dynamicSubscriptions() {
+		s.Cancel()
+	}
+
+	var err error
+	cfg.ownedLayers.Range(func(name, layer interface{}) bool {
+		if closer, ok := layer.(io.Closer); ok {
+			if e := closer.Close(); e != nil && e != ErrClosed {
+				err = multierr.Append(err, errors.Wrapf(e, "close layer[%s]", name))
+			}
+		}
+		return true
+	})
+
+	return err
+}
+
+// Close 关闭默认配置及所有注册的Asyncer，用于服务退出时释放资源
+func Close() error {
+	err := _cfg.Close()
+
+	_asyncers.Range(func(name, args interface{}) bool {
+		if closer, ok := args.(*AsyncerArgs).Ins.(io.Closer); ok {
+			if e := closer.Close(); e != nil && e != ErrClosed {
+				err = multierr.Append(err, errors.Wrapf(e, "close asyncer[%s]", name))
+			}
+		}
+		return true
+	})
+
+	return err
+}
+
 // 获取Layer访问的代理对象
 //
 //  layer := cfg.Layer("layer1", "layer2")
@@ -174,40 +298,89 @@ func PutLayer(p *LayerConfigProxy) {
 //  cfg.Get2("service_url", DefaultLayerName, "billing") // 尝试依次从默认配置，"billing"配置中查询service_url的配置
 //
 func (cfg *defaultConfig) Get2(keyPath string, layerNames ...string) (val interface{}) {
-	if len(layerNames) == 0 {
-		layerNames = cfg.defaultLayerNames.Load().([]string)
+	val, _ = cfg.lookup2(keyPath, layerNames...)
+
+	return
+}
+
+// lookup2 同Get2，同时返回配置值所在的Layer
+// 合并视图模式下，map节点返回合并后的值，Layer为优先级最高的Layer
+func (cfg *defaultConfig) lookup2(keyPath string, layerNames ...string) (val interface{}, layerName string) {
+	val, layerName = cfg.lookupRaw(keyPath, layerNames...)
+
+	return cfg.interpolated(keyPath, val, layerName, layerNames), layerName
+}
+
+// lookupRaw 同lookup2，不解析配置值中的引用
+func (cfg *defaultConfig) lookupRaw(keyPath string, layerNames ...string) (val interface{}, layerName string) {
+	searchNames := layerNames
+	if len(searchNames) == 0 {
+		searchNames = cfg.defaultLayerNames.Load().([]string)
 	}
 
-	for _, layerName := range layerNames {
-		if layer, ok := cfg.layers.Load(layerName); ok {
+	for _, name := range searchNames {
+		if layer, ok := cfg.layers.Load(name); ok {
 			val = layer.(Configer).Get(keyPath)
 			if val != nil {
-				break
+				if _, isMap := val.(map[string]interface{}); isMap && cfg.mergedViewEnabled() {
+					val = cfg.mergedValue(keyPath, layerNames...)
+				}
+				return val, name
 			}
 		}
 	}
 
-	return
+	return nil, ""
 }
 
 func Get(keyPath string, layerNames ...string) (val interface{}) {
 	return _cfg.Get2(keyPath, layerNames...)
 }
 
-func (cfg *defaultConfig) Watch2(notifier chan struct{}, layerNames ...string) {
-	if len(layerNames) == 0 {
-		layerNames = cfg.defaultLayerNames.Load().([]string)
-	}
+// 监听指定Layer的变化，未指定LayerNames，默认为DefaultLayerNames
+// 监听默认Layer时，之后添加的默认Layer也会被监听
+func (cfg *defaultConfig) Watch2(notifier chan struct{}, layerNames ...string) Subscription {
+	return cfg.subscribe(func(_ string, layer Configer) Subscription {
+		return layer.Watch(notifier)
+	}, layerNames...)
+}
 
-	for _, layerName := range layerNames {
-		if layer, ok := cfg.layers.Load(layerName); ok {
-			layer.(Configer).Watch(notifier)
-		}
+func Watch(notifier chan struct{}, layerNames ...string) Subscription {
+	return _cfg.Watch2(notifier, layerNames...)
+}
+
+// WatchContext 同Watch，ctx结束时自动取消订阅
+func WatchContext(ctx context.Context, notifier chan struct{}, layerNames ...string) Subscription {
+	return bindContext(ctx, _cfg.Watch2(notifier, layerNames...))
+}
+
+// 监听指定Layer中节点的变化，未指定LayerNames，默认为DefaultLayerNames
+// 各Layer独立触发回调，ChangeEvent.Layer为发生变化的Layer
+// 开启了引用解析时，被引用的节点变更导致解析后的值变化也会异步回调，此时ChangeEvent中为解析后的值
+func (cfg *defaultConfig) WatchKey2(keyPath string, fn func(ev ChangeEvent), layerNames ...string) Subscription {
+	sub := cfg.subscribe(func(layerName string, layer Configer) Subscription {
+		return watchKey(layer, keyPath, func(ev ChangeEvent) {
+			if ev.Layer == "" {
+				ev.Layer = layerName
+			}
+			fn(ev)
+		})
+	}, layerNames...)
+
+	if keyPath == RootKey || !cfg.interpolationEnabled() {
+		return sub
 	}
+
+	return multiSubscription{sub, cfg.watchReferences(keyPath, fn, layerNames...)}
+}
+
+func WatchKey(keyPath string, fn func(ev ChangeEvent), layerNames ...string) Subscription {
+	return _cfg.WatchKey2(keyPath, fn, layerNames...)
 }
 
-func Watch(notifier chan struct{}, layerNames ...string) {
-	_cfg.Watch2(notifier, layerNames...)
+// WatchKeyContext 同WatchKey，ctx结束时自动取消订阅
+func WatchKeyContext(ctx context.Context, keyPath string, fn func(ev ChangeEvent), layerNames ...string) Subscription {
+	return bindContext(ctx, _cfg.WatchKey2(keyPath, fn, layerNames...))
 }
 
 // 设置指定Layer的配置，LayerNames不传默认为DefaultLayerName
@@ -226,6 +399,10 @@ func (cfg *defaultConfig) Set2(keyPath string, value interface{}, layerNames ...
 		return nil
 	}
 
+	if cfg.isClosed() {
+		return ErrClosed
+	}
+
 	if len(layerNames) == 0 {
 		layerNames = []string{DefaultLayerName}
 	}
@@ -233,7 +410,10 @@ func (cfg *defaultConfig) Set2(keyPath string, value interface{}, layerNames ...
 	layerName := layerNames[0]
 
 	if layer, ok := cfg.layers.Load(layerName); ok {
-		return layer.(Configer).Set(keyPath, value)
+		err := layer.(Configer).Set(keyPath, value)
+		// 不支持KeyWatcher的Layer异步通知变更，Set返回前使合并视图失效
+		cfg.invalidateMergedView()
+		return err
 	}
 
 	return errors.Errorf("set config error, layer[%s] not exist", layerName)
@@ -261,6 +441,12 @@ func JSON(keyPath string, layerNames ...string) ([]byte, error) {
 	return p.JSON(keyPath)
 }
 
+func JSONRedacted(keyPath string, layerNames ...string) ([]byte, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.JSONRedacted(keyPath)
+}
+
 func Remarshal(keyPath string, v interface{}, layerNames ...string) error {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -273,6 +459,12 @@ func String(keyPath string, layerNames ...string) string {
 	return p.String(keyPath)
 }
 
+func StringE(keyPath string, layerNames ...string) (string, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.StringE(keyPath)
+}
+
 func StringDefault(keyPath string, dft string, layerNames ...string) (value string) {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -285,6 +477,12 @@ func Bytes(keyPath string, layerNames ...string) []byte {
 	return p.Bytes(keyPath)
 }
 
+func BytesE(keyPath string, layerNames ...string) ([]byte, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.BytesE(keyPath)
+}
+
 func BytesDefault(keyPath string, dft []byte, layerNames ...string) (value []byte) {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -297,6 +495,12 @@ func Float(keyPath string, layerNames ...string) float64 {
 	return p.Float(keyPath)
 }
 
+func FloatE(keyPath string, layerNames ...string) (float64, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.FloatE(keyPath)
+}
+
 func FloatDefault(keyPath string, dft float64, layerNames ...string) float64 {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -309,6 +513,12 @@ func Int(keyPath string, layerNames ...string) int64 {
 	return p.Int(keyPath)
 }
 
+func IntE(keyPath string, layerNames ...string) (int64, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.IntE(keyPath)
+}
+
 func IntDefault(keyPath string, dft int64, layerNames ...string) int64 {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -321,6 +531,12 @@ func Uint(keyPath string, layerNames ...string) uint64 {
 	return p.Uint(keyPath)
 }
 
+func UintE(keyPath string, layerNames ...string) (uint64, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.UintE(keyPath)
+}
+
 func UintDefault(keyPath string, dft uint64, layerNames ...string) uint64 {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
@@ -333,6 +549,12 @@ func Bool(keyPath string, layerNames ...string) bool {
 	return p.Bool(keyPath)
 }
 
+func BoolE(keyPath string, layerNames ...string) (bool, error) {
+	p := _cfg.Layer(layerNames...)
+	defer _cfg.PutLayer(p)
+	return p.BoolE(keyPath)
+}
+
 func BoolDefault(keyPath string, dft bool, layerNames ...string) bool {
 	p := _cfg.Layer(layerNames...)
 	defer _cfg.PutLayer(p)
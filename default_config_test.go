@@ -196,3 +196,37 @@ func TestDynamicConfFile(t *testing.T) {
 	}
 	ast.Equal("value1.1", String("c11"))
 }
+
+func TestConfigClose(t *testing.T) {
+	ast := assert.New(t)
+
+	asyncer := NewMockAsyncer(false)
+	asyncer.Set("close_layer", []byte(`{"a":1}`))
+	RegisterAsyner("mock-close", &AsyncerArgs{
+		Ins: asyncer,
+	})
+
+	cfg := newConfig()
+	cfg.AddLayer(DefaultLayerName, NewMapConfig(nil))
+	layer, err := cfg.Load("close_layer", "mock-close")
+	ast.Nil(err)
+	ast.Equal(int64(1), layer.Int("a"))
+
+	owned, _ := cfg.layers.Load("close_layer")
+	cfg.RemoveLayer("close_layer")
+	ast.Equal(ErrClosed, owned.(*AsyncConfig).Close())
+
+	// layers added by the caller are left open
+	external := NewAsyncConfig(asyncer, "close_layer", 0, false)
+	cfg.AddLayer("external", external)
+	_, err = cfg.Load("close_layer2", "mock-close")
+	ast.Nil(err)
+	owned, _ = cfg.layers.Load("close_layer2")
+
+	ast.Nil(cfg.Close())
+	ast.Equal(ErrClosed, owned.(*AsyncConfig).Close())
+	ast.Nil(external.Close())
+	ast.Equal(ErrClosed, cfg.Set("a", 1))
+	_, err = cfg.Load("close_layer", "mock-close")
+	ast.Equal(ErrClosed, err)
+}
@@ -3,5 +3,8 @@
 //  - 非静态配置的实时更新
 //  - 自定义配置源插件
 //  - 内容处理插件（加密配置，配置注释..)
+//  - 配置值加密（ENC[AES256_GCM,...]，见KeyProvider）
+//  - 配置内容签名校验（ed25519，见TrustedKeys）
+//  - 泛型读取：Value[T]、ValueDefault[T]、ValueE[T]（包级函数Get已用于读取原始值，故未命名为Get[T]）
 // 配置使用应该遵循写少读多的原则，设计上为了保证并发读取性能，写入性能比较低
 package config
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	encryptedPrefix = "ENC[AES256_GCM,"
+	encryptedSuffix = "]"
+
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+	aes256KeyLen = 32
+)
+
+var (
+	// ErrNoKeyProvider 配置中有加密的值，但未设置KeyProvider
+	ErrNoKeyProvider = errors.New("key provider not set")
+
+	_keyProviderMu sync.RWMutex
+	_keyProvider   KeyProvider
+)
+
+// KeyProvider 提供加解密配置值的AES-256密钥
+//
+// 配置中的加密值格式为 ENC[AES256_GCM,data:<base64>,iv:<base64>,tag:<base64>,kid:<keyID>]，
+// 异步配置加载时（条件值解析后）自动解密，解密失败时加载失败，解密后的值在Dump等输出中被掩码。
+// kid为加密时使用的密钥ID，更换密钥时将新密钥设为当前密钥，旧密钥保留用于解密已有的值
+type KeyProvider interface {
+	// Key 返回keyID对应的32字节密钥，keyID为空时返回当前用于加密的密钥及其ID
+	Key(keyID string) (id string, key []byte, err error)
+}
+
+// KeyProviderFunc 函数形式的KeyProvider
+type KeyProviderFunc func(keyID string) (string, []byte, error)
+
+func (f KeyProviderFunc) Key(keyID string) (string, []byte, error) {
+	return f(keyID)
+}
+
+// Keyring 本地密钥环
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring 创建密钥环，current为当前用于加密的密钥ID
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{
+		current: current,
+		keys:    make(map[string][]byte, len(keys)),
+	}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ",]:") {
+			return nil, errors.Errorf("invalid key id[%s]", id)
+		}
+		if len(key) != aes256KeyLen {
+			return nil, errors.Errorf("key[%s] must be %d bytes, got %d", id, aes256KeyLen, len(key))
+		}
+		k.keys[id] = key
+	}
+	if _, ok := k.keys[current]; !ok {
+		return nil, errors.Errorf("current key[%s] not found", current)
+	}
+
+	return k, nil
+}
+
+// ParseKeyring 解析 id:base64key 格式的密钥列表，以逗号或换行分隔，第一个为当前密钥，#开头的行为注释
+//
+//	2024-06:q0CPk...=
+//	2023-12:8fJx2...=
+func ParseKeyring(s string) (*Keyring, error) {
+	var (
+		current string
+		keys    = make(map[string][]byte)
+	)
+	err := parseKeyList(s, func(id string, key []byte) error {
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if current == "" {
+		return nil, errors.New("empty keyring")
+	}
+
+	return NewKeyring(current, keys)
+}
+
+func (k *Keyring) Key(keyID string) (string, []byte, error) {
+	if keyID == "" {
+		keyID = k.current
+	}
+	key, ok := k.keys[keyID]
+	if !ok {
+		return "", nil, errors.Errorf("key[%s] not found", keyID)
+	}
+
+	return keyID, key, nil
+}
+
+// EnvKeyProvider 从环境变量name中读取密钥环（格式见ParseKeyring），每次获取密钥时读取
+func EnvKeyProvider(name string) KeyProvider {
+	return KeyProviderFunc(func(keyID string) (string, []byte, error) {
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return "", nil, errors.Errorf("env[%s] not set", name)
+		}
+		k, err := ParseKeyring(s)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "env[%s]", name)
+		}
+		return k.Key(keyID)
+	})
+}
+
+// FileKeyProvider 从文件中读取密钥环（格式见ParseKeyring），每次获取密钥时读取
+func FileKeyProvider(file string) KeyProvider {
+	return KeyProviderFunc(func(keyID string) (string, []byte, error) {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", nil, err
+		}
+		k, err := ParseKeyring(string(content))
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "file[%s]", file)
+		}
+		return k.Key(keyID)
+	})
+}
+
+// NewKeyProvider 按描述创建KeyProvider：env:NAME 或 file:PATH
+func NewKeyProvider(spec string) (KeyProvider, error) {
+	switch {
+	case strings.HasPrefix(spec, "env:"):
+		return EnvKeyProvider(spec[len("env:"):]), nil
+	case strings.HasPrefix(spec, "file:"):
+		return FileKeyProvider(spec[len("file:"):]), nil
+	}
+
+	return nil, errors.Errorf("invalid key provider[%s], want env:NAME or file:PATH", spec)
+}
+
+// SetKeyProvider 设置解密配置值使用的KeyProvider
+func SetKeyProvider(p KeyProvider) {
+	_keyProviderMu.Lock()
+	defer _keyProviderMu.Unlock()
+	_keyProvider = p
+}
+
+func keyProvider() KeyProvider {
+	_keyProviderMu.RLock()
+	defer _keyProviderMu.RUnlock()
+	return _keyProvider
+}
+
+// IsEncrypted 返回s是否为加密的配置值
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix) && strings.HasSuffix(s, encryptedSuffix)
+}
+
+// EncryptValue 使用p的当前密钥加密配置值
+func EncryptValue(p KeyProvider, plaintext string) (string, error) {
+	id, key, err := p.Key("")
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	data, tag := sealed[:len(sealed)-gcmTagSize], sealed[len(sealed)-gcmTagSize:]
+
+	enc := base64.StdEncoding
+	return encryptedPrefix +
+		"data:" + enc.EncodeToString(data) +
+		",iv:" + enc.EncodeToString(iv) +
+		",tag:" + enc.EncodeToString(tag) +
+		",kid:" + id +
+		encryptedSuffix, nil
+}
+
+// DecryptValue 使用p解密配置值，value不是加密的值时返回错误
+func DecryptValue(p KeyProvider, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("not an encrypted value")
+	}
+
+	fields := make(map[string]string)
+	for _, item := range strings.Split(value[len(encryptedPrefix):len(value)-len(encryptedSuffix)], ",") {
+		idx := strings.Index(item, ":")
+		if idx <= 0 {
+			return "", errors.Errorf("invalid encrypted field[%s]", item)
+		}
+		fields[item[:idx]] = item[idx+1:]
+	}
+
+	var parts [3][]byte
+	for i, name := range []string{"data", "iv", "tag"} {
+		s, ok := fields[name]
+		if !ok {
+			return "", errors.Errorf("encrypted value missing %s", name)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", errors.Wrapf(err, "decode %s", name)
+		}
+		parts[i] = b
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+	if len(iv) != gcmNonceSize || len(tag) != gcmTagSize {
+		return "", errors.New("invalid iv or tag size")
+	}
+
+	// 未记录kid时使用当前密钥
+	_, key, err := p.Key(fields["kid"])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data[:len(data):len(data)], tag...), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypt")
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != aes256KeyLen {
+		return nil, errors.Errorf("key must be %d bytes, got %d", aes256KeyLen, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptValues 解密配置树中加密的值（原地修改），返回被解密的节点路径
+func decryptValues(tree interface{}) (interface{}, []string, error) {
+	var (
+		p     KeyProvider
+		paths []string
+	)
+
+	var walk func(keyPath string, val interface{}) (interface{}, error)
+	walk = func(keyPath string, val interface{}) (interface{}, error) {
+		switch v := val.(type) {
+		case string:
+			if !IsEncrypted(v) {
+				return v, nil
+			}
+			if p == nil {
+				if p = keyProvider(); p == nil {
+					return nil, errors.Wrapf(ErrNoKeyProvider, "path[%s]", keyPath)
+				}
+			}
+			plaintext, err := DecryptValue(p, v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "path[%s]", keyPath)
+			}
+			paths = append(paths, keyPath)
+			return plaintext, nil
+		case map[string]interface{}:
+			for k, item := range v {
+				decrypted, err := walk(joinKeyPath(keyPath, k), item)
+				if err != nil {
+					return nil, err
+				}
+				v[k] = decrypted
+			}
+		case []interface{}:
+			for i, item := range v {
+				decrypted, err := walk(joinKeyPath(keyPath, strconv.Itoa(i)), item)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = decrypted
+			}
+		}
+		return val, nil
+	}
+
+	tree, err := walk(RootKey, tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, paths, nil
+}
+
+// secretValues 返回paths节点解密后的值
+func secretValues(tree interface{}, paths []string) []string {
+	secrets := make([]string, 0, len(paths))
+	for _, keyPath := range paths {
+		if s, ok := subtree(tree, keyPath).(string); ok {
+			secrets = append(secrets, s)
+		}
+	}
+
+	return secrets
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptValue(t *testing.T) {
+	ast := assert.New(t)
+
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	enc := base64.StdEncoding.EncodeToString
+
+	old, err := ParseKeyring("old:" + enc(oldKey))
+	ast.Nil(err)
+	encrypted, err := EncryptValue(old, "s3cret")
+	ast.Nil(err)
+	ast.True(IsEncrypted(encrypted))
+	ast.True(strings.HasSuffix(encrypted, ",kid:old]"), encrypted)
+
+	// rotation: new values use the first key, old values still decrypt
+	os.Setenv("ENCRYPT_TEST_KEYS", "# rotated\nnew:"+enc(newKey)+"\nold:"+enc(oldKey))
+	defer os.Unsetenv("ENCRYPT_TEST_KEYS")
+	p, err := NewKeyProvider("env:ENCRYPT_TEST_KEYS")
+	ast.Nil(err)
+	plaintext, err := DecryptValue(p, encrypted)
+	ast.Nil(err)
+	ast.Equal("s3cret", plaintext)
+	rotated, err := EncryptValue(p, "s3cret")
+	ast.Nil(err)
+	ast.True(strings.HasSuffix(rotated, ",kid:new]"), rotated)
+	_, err = DecryptValue(old, rotated)
+	ast.Error(err)
+
+	// tampered data fails authentication
+	tampered := strings.Replace(encrypted, "data:", "data:AA", 1)
+	_, err = DecryptValue(p, tampered)
+	ast.Error(err)
+
+	_, err = ParseKeyring("short:" + enc([]byte("x")))
+	ast.Error(err)
+	_, err = NewKeyProvider("vault:x")
+	ast.Error(err)
+}
+
+func TestDecryptAsyncConfig(t *testing.T) {
+	ast := assert.New(t)
+
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	ast.Nil(err)
+	encrypted, err := EncryptValue(keyring, "p@ss")
+	ast.Nil(err)
+
+	key := "encrypt_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db": {"user": "root", "password": "` + encrypted + `"}}`),
+	}}
+
+	// no key provider
+	cfg := NewAsyncConfig(remote, key, 0, false)
+	ast.Nil(cfg.Get("db"))
+	ast.True(errors.Is(cfg.Configer.(*asyncConfig).Status().LastError, ErrNoKeyProvider))
+	cfg.Close()
+
+	SetKeyProvider(keyring)
+	defer SetKeyProvider(nil)
+
+	cfg = NewAsyncConfig(remote, key, 0, false)
+	defer cfg.Close()
+	ast.Equal("p@ss", cfg.String("db.password"))
+
+	// Set writes ciphertext back
+	ast.Nil(cfg.Set("db.user", "admin"))
+	ast.Equal("p@ss", cfg.String("db.password"))
+	content := string(remote.Get(key))
+	ast.NotContains(content, "p@ss")
+	ast.Contains(content, `"admin"`)
+
+	reloaded := NewAsyncConfig(remote, key, time.Millisecond, false)
+	defer reloaded.Close()
+	ast.Equal("p@ss", reloaded.String("db.password"))
+	ast.Equal("admin", reloaded.String("db.user"))
+}
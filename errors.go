@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrKeyNotFound 指定节点不存在配置
+	ErrKeyNotFound = errors.New("config key not found")
+
+	// ErrClosed 配置对象或Asyncer已关闭
+	ErrClosed = errors.New("config closed")
+
+	// ErrEmptyContent 异步配置获取到的内容为空（不存在或获取失败）
+	ErrEmptyContent = errors.New("empty config content")
+
+	// ErrComposedConfig 异步配置使用了引用、条件值或YAML标签，Set写回会丢失这些内容
+	ErrComposedConfig = errors.New("cannot set config composed by includes, selectors or yaml tags")
+)
+
+// TypeError 配置值无法转换为期望的类型，Got中的敏感值已掩码
+type TypeError struct {
+	KeyPath string
+	Want    string
+	Got     string
+	Layer   string
+}
+
+func newTypeError(keyPath string, want string, got interface{}, layer string) *TypeError {
+	return &TypeError{
+		KeyPath: keyPath,
+		Want:    want,
+		Got:     fmt.Sprintf("%T(%v)", got, Redact(keyPath, got)),
+		Layer:   layer,
+	}
+}
+
+func (e *TypeError) Error() string {
+	if e.Layer == "" {
+		return fmt.Sprintf("config[%s] type error: want %s, got %s", e.KeyPath, e.Want, e.Got)
+	}
+
+	return fmt.Sprintf("config[%s] type error: want %s, got %s from layer[%s]", e.KeyPath, e.Want, e.Got, e.Layer)
+}
+
+func keyNotFoundError(keyPath string) error {
+	return errors.Wrapf(ErrKeyNotFound, "path[%s]", keyPath)
+}
+
+func isKeyNotFound(err error) bool {
+	return errors.Is(err, ErrKeyNotFound)
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LayerValue 配置节点在单个Layer中的值及该Layer的来源信息
+type LayerValue struct {
+	Layer string      `json:"layer"`
+	Value interface{} `json:"value"` // 该Layer中不存在时为nil
+
+	// 来源信息，无需加载的Layer（如MapConfig、运行时Set）为空
+	Source   string    `json:"source,omitempty"`
+	Version  Version   `json:"version,omitempty"`
+	LoadTime time.Time `json:"load_time,omitempty"`
+}
+
+// Explanation 配置节点的来源说明
+type Explanation struct {
+	KeyPath string `json:"key_path"`
+
+	// 最终生效的值及其所在的Layer，所有Layer都不存在时Winner为nil
+	Value  interface{} `json:"value"`
+	Winner *LayerValue `json:"winner,omitempty"`
+
+	// 按查找顺序排列的各Layer的值，不存在的Layer被忽略
+	Layers []LayerValue `json:"layers"`
+}
+
+// Explain 返回配置节点在各Layer中的值及最终生效的Layer，未指定LayerNames，默认为DefaultLayerNames
+//
+//	ex := cfg.Explain("db.host")
+//	fmt.Println(ex.Winner.Layer, ex.Winner.Source, ex.Winner.Version)
+func (cfg *defaultConfig) Explain(keyPath string, layerNames ...string) *Explanation {
+	if len(layerNames) == 0 {
+		layerNames = cfg.defaultLayerNames.Load().([]string)
+	}
+
+	ex := &Explanation{
+		KeyPath: keyPath,
+	}
+
+	winner := -1
+	for _, name := range layerNames {
+		layer, ok := cfg.layers.Load(name)
+		if !ok {
+			continue
+		}
+
+		lv := LayerValue{
+			Layer: name,
+			Value: layer.(Configer).Get(keyPath),
+		}
+		if s, ok := layer.(statuser); ok {
+			status := s.Status()
+			lv.Source = status.Source
+			lv.Version = status.Version
+			lv.LoadTime = status.LoadTime
+		}
+		if winner < 0 && lv.Value != nil {
+			winner = len(ex.Layers)
+		}
+		ex.Layers = append(ex.Layers, lv)
+	}
+
+	if winner >= 0 {
+		ex.Winner = &ex.Layers[winner]
+		ex.Value = ex.Winner.Value
+	}
+
+	return ex
+}
+
+func Explain(keyPath string, layerNames ...string) *Explanation {
+	return _cfg.Explain(keyPath, layerNames...)
+}
+
+// Redacted 返回敏感值被替换为RedactMask的副本，用于输出到调试接口或日志
+func (ex *Explanation) Redacted() *Explanation {
+	r := &Explanation{
+		KeyPath: ex.KeyPath,
+		Value:   Redact(ex.KeyPath, ex.Value),
+		Layers:  make([]LayerValue, len(ex.Layers)),
+	}
+	for i, lv := range ex.Layers {
+		lv.Value = Redact(ex.KeyPath, lv.Value)
+		r.Layers[i] = lv
+		if ex.Winner == &ex.Layers[i] {
+			r.Winner = &r.Layers[i]
+		}
+	}
+
+	return r
+}
+
+// DumpAnnotated 打印指定节点下的所有叶子节点，并注明其所在的Layer及来源，敏感值被替换为RedactMask
+//
+//	db.host = "example.com" # layer=default-conf-redis-0 source=app_config version=...
+func (cfg *defaultConfig) DumpAnnotated(keyPath string, layerNames ...string) {
+	for _, line := range cfg.annotate(keyPath, layerNames...) {
+		fmt.Println(line)
+	}
+}
+
+func DumpAnnotated(keyPath string, layerNames ...string) {
+	_cfg.DumpAnnotated(keyPath, layerNames...)
+}
+
+func (cfg *defaultConfig) annotate(keyPath string, layerNames ...string) []string {
+	var lines []string
+
+	var walk func(path string, val interface{})
+	walk = func(path string, val interface{}) {
+		if m, ok := val.(map[string]interface{}); ok && len(m) > 0 {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(joinKeyPath(path, k), m[k])
+			}
+			return
+		}
+
+		data, _ := json.Marshal(Redact(path, val))
+		lines = append(lines, fmt.Sprintf("%s = %s # %s", path, data, cfg.Explain(path, layerNames...).annotation()))
+	}
+
+	if val := cfg.Get2(keyPath, layerNames...); val != nil {
+		walk(keyPath, val)
+	}
+
+	return lines
+}
+
+func (ex *Explanation) annotation() string {
+	if ex.Winner == nil {
+		return "layer=<none>"
+	}
+
+	parts := []string{"layer=" + ex.Winner.Layer}
+	if ex.Winner.Source != "" {
+		parts = append(parts, "source="+ex.Winner.Source)
+	}
+	if ex.Winner.Version != "" {
+		parts = append(parts, "version="+string(ex.Winner.Version))
+	}
+	if !ex.Winner.LoadTime.IsZero() {
+		parts = append(parts, "load_time="+ex.Winner.LoadTime.Format(time.RFC3339))
+	}
+
+	// 被覆盖的Layer
+	var shadowed []string
+	for _, lv := range ex.Layers {
+		if lv.Value != nil && lv.Layer != ex.Winner.Layer {
+			shadowed = append(shadowed, lv.Layer)
+		}
+	}
+	if len(shadowed) > 0 {
+		parts = append(parts, "shadows="+strings.Join(shadowed, ","))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	cfg.AddLayer(DefaultLayerName, NewMapConfig(map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"port": 3306,
+		},
+	}))
+
+	key := "explain_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db":{"host":"example.com"}}`),
+	}}
+	remoteCfg := NewAsyncConfig(remote, key, 0, false)
+	cfg.AddLayer("remote", remoteCfg)
+	cfg.AddDefaultLayerName("remote")
+
+	ex := cfg.Explain("db.host")
+	ast.Equal("example.com", ex.Value)
+	ast.Equal("remote", ex.Winner.Layer)
+	ast.Equal(key, ex.Winner.Source)
+	ast.Equal(contentVersion([]byte(`{"db":{"host":"example.com"}}`)), ex.Winner.Version)
+	ast.False(ex.Winner.LoadTime.IsZero())
+	ast.Len(ex.Layers, 2)
+	ast.Equal(DefaultLayerName, ex.Layers[1].Layer)
+	ast.Equal("localhost", ex.Layers[1].Value)
+
+	ex = cfg.Explain("db.port")
+	ast.Equal(DefaultLayerName, ex.Winner.Layer)
+	ast.Nil(ex.Layers[0].Value)
+	ast.Empty(ex.Winner.Source)
+
+	ex = cfg.Explain("db.user")
+	ast.Nil(ex.Winner)
+	ast.Nil(ex.Value)
+
+	// only the winning subtree is dumped
+	lines := cfg.annotate("db")
+	ast.Len(lines, 1)
+	ast.Regexp(`^db\.host = "example\.com" # layer=remote source=explain_key version=\w+ load_time=\S+ shadows=default$`, lines[0])
+
+	lines = cfg.annotate("db.host", DefaultLayerName)
+	ast.Equal([]string{`db.host = "localhost" # layer=default`}, lines)
+}
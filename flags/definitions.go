@@ -0,0 +1,88 @@
+package flags
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/techxmind/config"
+)
+
+// definitions 缓存从配置中解析的定义（开关、实验），配置变更时整体失效
+type definitions[T any] struct {
+	cfg     config.Config
+	keyPath string
+	parse   func(val interface{}) T
+	sub     config.Subscription
+
+	mu    sync.Mutex
+	cache atomic.Value //*definitionCache[T]
+}
+
+type definitionCache[T any] struct {
+	entries map[string]T
+}
+
+func newDefinitions[T any](cfg config.Config, keyPath string, parse func(val interface{}) T) *definitions[T] {
+	d := &definitions[T]{
+		cfg:     cfg,
+		keyPath: keyPath,
+		parse:   parse,
+	}
+	d.cache.Store(&definitionCache[T]{})
+	d.sub = cfg.WatchKey(keyPath, func(config.ChangeEvent) {
+		d.invalidate()
+	})
+
+	return d
+}
+
+func (d *definitions[T]) close() {
+	d.sub.Cancel()
+}
+
+func (d *definitions[T]) invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cache.Store(&definitionCache[T]{})
+}
+
+// lookup 返回解析后的定义，ctx通过config.WithLayers附加了Layer时，从ctx的Layer中读取（不缓存）
+func (d *definitions[T]) lookup(ctx context.Context, name string) T {
+	if len(config.LayersFromContext(ctx)) > 0 {
+		return d.parse(config.GetCtx(ctx, d.keyPathOf(name)))
+	}
+
+	cache := d.cache.Load().(*definitionCache[T])
+	if entry, ok := cache.entries[name]; ok {
+		return entry
+	}
+
+	entry := d.parse(d.cfg.Get(d.keyPathOf(name)))
+
+	// 写时复制；解析期间缓存已失效时不写入，避免旧定义进入新的缓存
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cache.Load().(*definitionCache[T]) != cache {
+		return entry
+	}
+	next := &definitionCache[T]{
+		entries: make(map[string]T, len(cache.entries)+1),
+	}
+	for k, v := range cache.entries {
+		next.entries[k] = v
+	}
+	next.entries[name] = entry
+	d.cache.Store(next)
+
+	return entry
+}
+
+func (d *definitions[T]) keyPathOf(name string) string {
+	if d.keyPath == config.RootKey {
+		return name
+	}
+
+	return d.keyPath + "." + name
+}
@@ -0,0 +1,191 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/mohae/deepcopy"
+	"github.com/pkg/errors"
+
+	"github.com/techxmind/config"
+)
+
+// DefaultExperimentKeyPath 默认的实验定义节点
+const DefaultExperimentKeyPath = "experiments"
+
+// Experiment 实验定义
+//
+//	{
+//		"experiments": {
+//			"checkout_button": {
+//				"enabled": true,
+//				"salt": "v1",                    // 修改salt可重新分组
+//				"group": "checkout",             // 互斥组，同组实验的range不重叠时，一个单元最多进入其中一个实验
+//				"range": [0, 50],                // 进入实验的组内流量区间[start, end)，0-100，未设置为全部流量
+//				"variants": [
+//					{"name": "control", "weight": 50},
+//					{"name": "blue", "weight": 50, "params": {"color": "blue"}}
+//				]
+//			}
+//		}
+//	}
+//
+// 变体按权重分配（加权rendezvous hash），调整单个变体的权重时只移动必要的单元：
+// 增加权重或新增变体时，只有移入该变体的单元改变分组，数量即为该变体增加的流量；
+// 减少权重或删除变体时，只有该变体的单元改变分组。同时调整多个变体时可能移动更多单元
+//
+// 同组实验按组名分桶（不使用各自的salt），保证各实验的range落在同一组流量区间上
+type Experiment struct {
+	Enabled  bool         `json:"enabled"`
+	Salt     string       `json:"salt,omitempty"`
+	Group    string       `json:"group,omitempty"`
+	Range    []float64    `json:"range,omitempty"`
+	Variants []VariantDef `json:"variants"`
+}
+
+// VariantDef 实验变体定义
+type VariantDef struct {
+	Name   string                 `json:"name"`
+	Weight float64                `json:"weight"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+type experimentEntry struct {
+	exp *Experiment
+	err error
+}
+
+// Experiments 从配置中读取实验定义并分配变体
+type Experiments struct {
+	defs *definitions[*experimentEntry]
+}
+
+// NewExperiments 创建读取cfg中keyPath节点的实验，keyPath下的配置变更时自动重新加载
+func NewExperiments(cfg config.Config, keyPath string) *Experiments {
+	return &Experiments{
+		defs: newDefinitions(cfg, keyPath, parseExperiment),
+	}
+}
+
+// Close 停止监听配置变更
+func (e *Experiments) Close() {
+	e.defs.close()
+}
+
+func parseExperiment(val interface{}) *experimentEntry {
+	if val == nil {
+		return &experimentEntry{}
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return &experimentEntry{err: err}
+	}
+	exp := &Experiment{}
+	if err := json.Unmarshal(data, exp); err != nil {
+		return &experimentEntry{err: err}
+	}
+	if len(exp.Range) != 0 && len(exp.Range) != 2 {
+		return &experimentEntry{err: errors.Errorf("invalid range %v, want [start, end]", exp.Range)}
+	}
+
+	return &experimentEntry{exp: exp}
+}
+
+// Variant 返回单元（如用户ID）在实验中分配到的变体名称及参数
+// 实验不存在、定义无效、未开启或单元不在实验流量中时，返回空名称及空参数
+// 每次调用返回参数的副本，修改不影响实验定义
+func (e *Experiments) Variant(experiment string, unitID string) (string, *config.MapConfig) {
+	return e.VariantContext(context.Background(), experiment, unitID)
+}
+
+// VariantContext 同Variant，ctx通过config.WithLayers附加了Layer时，从ctx的Layer中读取实验定义
+func (e *Experiments) VariantContext(ctx context.Context, experiment string, unitID string) (string, *config.MapConfig) {
+	entry := e.defs.lookup(ctx, experiment)
+	if entry.exp == nil || !entry.exp.Enabled {
+		return "", config.NewMapConfig(nil)
+	}
+
+	i := entry.exp.assign(experiment, unitID)
+	if i < 0 {
+		return "", config.NewMapConfig(nil)
+	}
+
+	v := entry.exp.Variants[i]
+	params, _ := deepcopy.Copy(v.Params).(map[string]interface{})
+
+	return v.Name, config.NewMapConfig(params)
+}
+
+// assign 返回单元分配到的变体下标，不在实验流量中时返回-1
+func (exp *Experiment) assign(name string, unitID string) int {
+	// 互斥组内的实验共享分桶，未设置group时实验自成一组，使用实验的salt
+	group, salt := exp.Group, ""
+	if group == "" {
+		group, salt = name, exp.Salt
+	}
+
+	if len(exp.Range) == 2 {
+		b := unitHash(group, salt, unitID) * 100
+		if b < exp.Range[0] || b >= exp.Range[1] {
+			return -1
+		}
+	}
+
+	// 加权rendezvous hash：score = -weight / ln(h)，取最大值
+	best, bestScore := -1, math.Inf(-1)
+	for i, v := range exp.Variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		h := unitHash(name+"\x00"+v.Name, exp.Salt, unitID)
+		score := -v.Weight / math.Log(h)
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return best
+}
+
+// unitHash 返回(0, 1)区间内稳定的hash值
+func unitHash(key, salt, unitID string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(unitID))
+
+	// fnv的高位分布不均匀，使用splitmix64的终结函数打散
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return (float64(x>>11) + 0.5) / (1 << 53)
+}
+
+var (
+	_defaultExperimentsOnce sync.Once
+	_defaultExperiments     *Experiments
+)
+
+// DefaultExperiments 返回读取默认配置experiments节点的实验
+func DefaultExperiments() *Experiments {
+	_defaultExperimentsOnce.Do(func() {
+		_defaultExperiments = NewExperiments(config.Layer(), DefaultExperimentKeyPath)
+	})
+
+	return _defaultExperiments
+}
+
+// Variant 使用默认配置的实验分配变体，见Experiments.Variant
+func Variant(experiment string, unitID string) (string, *config.MapConfig) {
+	return DefaultExperiments().Variant(experiment, unitID)
+}
@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/techxmind/config"
+)
+
+func TestExperiments(t *testing.T) {
+	ast := assert.New(t)
+
+	tree, err := config.JSONToMap([]byte(`
+	{
+		"experiments": {
+			"button": {
+				"enabled": true,
+				"variants": [
+					{"name": "control", "weight": 50},
+					{"name": "blue", "weight": 30, "params": {"color": "blue"}},
+					{"name": "red", "weight": 20, "params": {"color": "red"}}
+				]
+			},
+			"a": {"enabled": true, "group": "g", "range": [0, 40], "variants": [{"name": "on", "weight": 1}]},
+			"b": {"enabled": true, "group": "g", "salt": "v2", "range": [40, 100], "variants": [{"name": "on", "weight": 1}]},
+			"bad_range": {"enabled": true, "range": [50], "variants": [{"name": "on", "weight": 1}]},
+			"off": {"enabled": false, "variants": [{"name": "on", "weight": 1}]}
+		}
+	}
+	`))
+	ast.Nil(err)
+	cfg := config.NewMapConfig(tree)
+	e := NewExperiments(cfg, DefaultExperimentKeyPath)
+	defer e.Close()
+
+	name, params := e.Variant("missing", "u1")
+	ast.Equal("", name)
+	ast.Nil(params.Get("color"))
+	name, _ = e.Variant("off", "u1")
+	ast.Equal("", name)
+	name, _ = e.Variant("bad_range", "u1")
+	ast.Equal("", name)
+
+	// stable assignment close to the weights
+	const units = 10000
+	assigned := make(map[string]string, units)
+	counts := make(map[string]int)
+	for i := 0; i < units; i++ {
+		unit := fmt.Sprintf("user-%d", i)
+		name, params := e.Variant("button", unit)
+		again, _ := e.Variant("button", unit)
+		ast.Equal(name, again)
+		if name != "control" {
+			ast.Equal(name, params.String("color"))
+		}
+		assigned[unit] = name
+		counts[name]++
+	}
+	ast.InDelta(5000, counts["control"], 300)
+	ast.InDelta(3000, counts["blue"], 300)
+	ast.InDelta(2000, counts["red"], 300)
+
+	// params are copies, changes do not affect other units
+	for unit, name := range assigned {
+		if name == "blue" {
+			_, params := e.Variant("button", unit)
+			ast.Nil(params.Set("color", "changed"))
+			_, params = e.Variant("button", unit)
+			ast.Equal("blue", params.String("color"))
+			break
+		}
+	}
+
+	// exclusive group, salts of the experiments do not affect the group buckets
+	inA, inB := 0, 0
+	for i := 0; i < units; i++ {
+		unit := fmt.Sprintf("user-%d", i)
+		a, _ := e.Variant("a", unit)
+		b, _ := e.Variant("b", unit)
+		ast.False(a != "" && b != "", unit)
+		if a != "" {
+			inA++
+		}
+		if b != "" {
+			inB++
+		}
+	}
+	ast.InDelta(4000, inA, 300)
+	ast.Equal(units, inA+inB)
+
+	// hot reload: raising one weight only moves units into that variant, 30% -> 50/120
+	ast.Nil(cfg.Set("experiments.button.variants.1.weight", 50))
+	moved := 0
+	for unit, before := range assigned {
+		after, _ := e.Variant("button", unit)
+		if after != before {
+			moved++
+			ast.Equal("blue", after, unit)
+		}
+		assigned[unit] = after
+	}
+	ast.InDelta(units*(50.0/120-0.3), moved, 300)
+
+	// adding a variant only takes units from the others, 20/140
+	variants := cfg.Get("experiments.button.variants").([]interface{})
+	ast.Nil(cfg.Set("experiments.button.variants", append(variants, map[string]interface{}{"name": "green", "weight": 20})))
+	moved = 0
+	for unit, before := range assigned {
+		after, _ := e.Variant("button", unit)
+		if after != before {
+			moved++
+			ast.Equal("green", after, unit)
+		}
+	}
+	ast.InDelta(units*20.0/140, moved, 300)
+}
@@ -0,0 +1,276 @@
+// Package flags 基于配置的功能开关
+//
+// 开关定义保存在配置的flags节点下（可通过New指定其它节点），配置变更时自动重新加载：
+//
+//	{
+//		"flags": {
+//			"new_ui": {
+//				"enabled": true,                 // 总开关，false时对所有用户关闭
+//				"percentage": 20,                // 灰度比例(0-100)，未设置为100
+//				"allow": ["u1", "u2"],           // 白名单，总是开启
+//				"deny": ["u3"],                  // 黑名单，总是关闭（优先于白名单）
+//				"rules": [                       // 属性规则，第一个匹配的规则决定结果
+//					{"attrs": {"country": ["cn", "us"], "env": "prod"}, "percentage": 50},
+//					{"attrs": {"plan": "free"}, "enabled": false}
+//				],
+//				"salt": "v2"                     // 修改salt可重新分桶
+//			}
+//		}
+//	}
+//
+// 同一subjectID对同一开关的分桶结果是稳定的，灰度比例增加时已开启的用户保持开启
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/techxmind/config"
+)
+
+// DefaultKeyPath 默认的开关定义节点
+const DefaultKeyPath = "flags"
+
+// Reason 开关的求值原因
+type Reason string
+
+const (
+	ReasonNotFound Reason = "not_found" // 开关未定义
+	ReasonInvalid  Reason = "invalid"   // 开关定义格式错误
+	ReasonDisabled Reason = "disabled"  // 总开关关闭
+	ReasonDenied   Reason = "denied"    // 命中黑名单
+	ReasonAllowed  Reason = "allowed"   // 命中白名单
+	ReasonRule     Reason = "rule"      // 命中属性规则
+	ReasonRollout  Reason = "rollout"   // 按灰度比例
+)
+
+// Flag 开关定义
+type Flag struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage *float64 `json:"percentage,omitempty"`
+	Allow      []string `json:"allow,omitempty"`
+	Deny       []string `json:"deny,omitempty"`
+	Rules      []Rule   `json:"rules,omitempty"`
+	Salt       string   `json:"salt,omitempty"`
+}
+
+// Rule 属性规则，Attrs中所有属性都匹配时命中（属性值为数组时匹配其中任一值）
+// Enabled未设置为true，Percentage未设置为100
+type Rule struct {
+	Attrs      map[string]interface{} `json:"attrs"`
+	Enabled    *bool                  `json:"enabled,omitempty"`
+	Percentage *float64               `json:"percentage,omitempty"`
+}
+
+// Result 开关的求值结果
+type Result struct {
+	Flag    string
+	Enabled bool
+	Reason  Reason
+
+	// 命中的规则下标，未命中规则时为-1
+	Rule int
+
+	// subjectID的分桶值[0, 100)，未分桶时为-1
+	Bucket float64
+
+	// 开关定义格式错误时的错误
+	Err error
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("flag[%s] enabled=%v reason=%s", r.Flag, r.Enabled, r.Reason)
+	if r.Rule >= 0 {
+		s += fmt.Sprintf(" rule=%d", r.Rule)
+	}
+	if r.Bucket >= 0 {
+		s += fmt.Sprintf(" bucket=%.2f", r.Bucket)
+	}
+	if r.Err != nil {
+		s += fmt.Sprintf(" err=%v", r.Err)
+	}
+
+	return s
+}
+
+// Flags 从配置中读取开关定义并求值
+type Flags struct {
+	defs *definitions[*flagEntry]
+}
+
+type flagEntry struct {
+	flag *Flag
+	err  error
+}
+
+// New 创建读取cfg中keyPath节点的开关，keyPath下的配置变更时自动重新加载
+func New(cfg config.Config, keyPath string) *Flags {
+	return &Flags{
+		defs: newDefinitions(cfg, keyPath, parseFlag),
+	}
+}
+
+// Close 停止监听配置变更
+func (f *Flags) Close() {
+	f.defs.close()
+}
+
+func parseFlag(val interface{}) *flagEntry {
+	if val == nil {
+		return &flagEntry{}
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return &flagEntry{err: err}
+	}
+	flag := &Flag{}
+	if err := json.Unmarshal(data, flag); err != nil {
+		return &flagEntry{err: err}
+	}
+
+	return &flagEntry{flag: flag}
+}
+
+// Enabled 返回开关对subjectID（如用户ID）是否开启，attrs为用于匹配规则的属性，
+// 未在attrs中指定的属性使用config.InstanceAttributes
+func (f *Flags) Enabled(ctx context.Context, name string, subjectID string, attrs map[string]string) bool {
+	return f.Evaluate(ctx, name, subjectID, attrs).Enabled
+}
+
+// Evaluate 同Enabled，同时返回求值原因，用于排查问题
+func (f *Flags) Evaluate(ctx context.Context, name string, subjectID string, attrs map[string]string) Result {
+	r := Result{
+		Flag:   name,
+		Rule:   -1,
+		Bucket: -1,
+	}
+
+	entry := f.defs.lookup(ctx, name)
+	if entry.err != nil {
+		r.Reason, r.Err = ReasonInvalid, entry.err
+		return r
+	}
+	flag := entry.flag
+	if flag == nil {
+		r.Reason = ReasonNotFound
+		return r
+	}
+
+	if !flag.Enabled {
+		r.Reason = ReasonDisabled
+		return r
+	}
+	if contains(flag.Deny, subjectID) {
+		r.Reason = ReasonDenied
+		return r
+	}
+	if contains(flag.Allow, subjectID) {
+		r.Enabled, r.Reason = true, ReasonAllowed
+		return r
+	}
+
+	r.Bucket = bucket(name, flag.Salt, subjectID)
+
+	if len(flag.Rules) > 0 {
+		instanceAttrs := config.InstanceAttributes()
+		for i, rule := range flag.Rules {
+			if !rule.match(attrs, instanceAttrs) {
+				continue
+			}
+			r.Reason, r.Rule = ReasonRule, i
+			r.Enabled = (rule.Enabled == nil || *rule.Enabled) && r.Bucket < percentage(rule.Percentage)
+			return r
+		}
+	}
+
+	r.Reason = ReasonRollout
+	r.Enabled = r.Bucket < percentage(flag.Percentage)
+
+	return r
+}
+
+func (rule *Rule) match(attrs, instanceAttrs map[string]string) bool {
+	for name, cond := range rule.Attrs {
+		attr, ok := attrs[name]
+		if !ok {
+			if attr, ok = instanceAttrs[name]; !ok {
+				return false
+			}
+		}
+
+		if candidates, ok := cond.([]interface{}); ok {
+			matched := false
+			for _, c := range candidates {
+				if fmt.Sprint(c) == attr {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		} else if fmt.Sprint(cond) != attr {
+			return false
+		}
+	}
+
+	return true
+}
+
+func percentage(p *float64) float64 {
+	if p == nil {
+		return 100
+	}
+
+	return *p
+}
+
+// bucket 返回subjectID在开关下稳定的分桶值[0, 100)，精度0.01
+func bucket(name, salt, subjectID string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(subjectID))
+
+	return float64(h.Sum32()%10000) / 100
+}
+
+func contains(items []string, item string) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	_defaultOnce  sync.Once
+	_defaultFlags *Flags
+)
+
+// Default 返回读取默认配置flags节点的开关
+func Default() *Flags {
+	_defaultOnce.Do(func() {
+		_defaultFlags = New(config.Layer(), DefaultKeyPath)
+	})
+
+	return _defaultFlags
+}
+
+// Enabled 使用默认配置的开关求值，见Flags.Enabled
+func Enabled(ctx context.Context, name string, subjectID string, attrs map[string]string) bool {
+	return Default().Enabled(ctx, name, subjectID, attrs)
+}
+
+// Evaluate 使用默认配置的开关求值，见Flags.Evaluate
+func Evaluate(ctx context.Context, name string, subjectID string, attrs map[string]string) Result {
+	return Default().Evaluate(ctx, name, subjectID, attrs)
+}
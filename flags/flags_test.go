@@ -0,0 +1,103 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/techxmind/config"
+)
+
+func TestFlags(t *testing.T) {
+	ast := assert.New(t)
+
+	tree, err := config.JSONToMap([]byte(`
+	{
+		"flags": {
+			"off": {"enabled": false, "allow": ["u1"]},
+			"all": {"enabled": true},
+			"list": {"enabled": true, "percentage": 0, "allow": ["u1", "u2"], "deny": ["u2"]},
+			"rollout": {"enabled": true, "percentage": 30},
+			"rules": {
+				"enabled": true,
+				"percentage": 0,
+				"rules": [
+					{"attrs": {"plan": "free"}, "enabled": false},
+					{"attrs": {"country": ["cn", "us"], "env": "prod"}}
+				]
+			},
+			"bad": {"enabled": "yes"}
+		}
+	}
+	`))
+	ast.Nil(err)
+	cfg := config.NewMapConfig(tree)
+	f := New(cfg, DefaultKeyPath)
+	defer f.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		flag    string
+		subject string
+		attrs   map[string]string
+		enabled bool
+		reason  Reason
+	}{
+		{"missing", "u1", nil, false, ReasonNotFound},
+		{"bad", "u1", nil, false, ReasonInvalid},
+		{"off", "u1", nil, false, ReasonDisabled},
+		{"all", "u1", nil, true, ReasonRollout},
+		{"list", "u1", nil, true, ReasonAllowed},
+		{"list", "u2", nil, false, ReasonDenied},
+		{"list", "u3", nil, false, ReasonRollout},
+		{"rules", "u1", map[string]string{"plan": "free", "country": "cn", "env": "prod"}, false, ReasonRule},
+		{"rules", "u1", map[string]string{"country": "us", "env": "prod"}, true, ReasonRule},
+		{"rules", "u1", map[string]string{"country": "jp", "env": "prod"}, false, ReasonRollout},
+	}
+	for _, test := range tests {
+		r := f.Evaluate(ctx, test.flag, test.subject, test.attrs)
+		ast.Equal(test.enabled, r.Enabled, r.String())
+		ast.Equal(test.reason, r.Reason, r.String())
+	}
+	ast.Equal(1, f.Evaluate(ctx, "rules", "u1", map[string]string{"country": "us", "env": "prod"}).Rule)
+
+	// stable bucketing close to the percentage
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		e := f.Enabled(ctx, "rollout", subject, nil)
+		ast.Equal(e, f.Enabled(ctx, "rollout", subject, nil))
+		if e {
+			enabled++
+		}
+	}
+	ast.InDelta(3000, enabled, 300)
+
+	// hot reload
+	ast.Nil(cfg.Set("flags.all.enabled", false))
+	ast.False(f.Enabled(ctx, "all", "u1", nil))
+	ast.Nil(cfg.Set("flags.missing", map[string]interface{}{"enabled": true}))
+	ast.True(f.Enabled(ctx, "missing", "u1", nil))
+}
+
+func TestDefaultFlags(t *testing.T) {
+	ast := assert.New(t)
+
+	ctx := context.Background()
+	ast.False(Enabled(ctx, "default_flag", "u1", nil))
+	ast.Nil(config.Set("flags.default_flag.enabled", true))
+	defer config.Set("flags.default_flag.enabled", false)
+	ast.True(Enabled(ctx, "default_flag", "u1", nil))
+
+	// tenant override via context layers
+	config.AddLayer("flags-tenant", config.NewMapConfig(map[string]interface{}{
+		"flags": map[string]interface{}{
+			"default_flag": map[string]interface{}{"enabled": false},
+		},
+	}))
+	defer config.RemoveLayer("flags-tenant")
+	ast.False(Enabled(config.WithLayers(ctx, "flags-tenant"), "default_flag", "u1", nil))
+	ast.Equal(ReasonDisabled, Evaluate(config.WithLayers(ctx, "flags-tenant"), "default_flag", "u1", nil).Reason)
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+
+	"github.com/mohae/deepcopy"
+)
+
+// Value 返回指定节点T类型的配置值，节点不存在或类型不匹配时返回T的零值
+//
+// 基础类型的转换规则与String/Int/...等方法一致，其它类型（结构体、slice等）通过JSON重新解析，
+// map、slice等容器类型返回的是副本，修改不影响配置
+//
+//	port := config.Value[int](cfg, "db.port")
+//	hosts := config.Value[[]string](config.Layer("billing"), "db.hosts")
+func Value[T any](cfg Configer, keyPath string) T {
+	v, _ := ValueE[T](cfg, keyPath)
+
+	return v
+}
+
+// ValueDefault 返回指定节点T类型的配置值，节点不存在则返回默认值
+func ValueDefault[T any](cfg Configer, keyPath string, dft T) T {
+	v, err := ValueE[T](cfg, keyPath)
+	if isKeyNotFound(err) {
+		return dft
+	}
+
+	return v
+}
+
+// ValueE 返回指定节点T类型的配置值，节点不存在返回ErrKeyNotFound，类型不匹配返回*TypeError
+func ValueE[T any](cfg Configer, keyPath string) (T, error) {
+	var (
+		zero      T
+		ival      interface{}
+		layerName string
+	)
+
+	if l, ok := cfg.(layerLookuper); ok {
+		ival, layerName = l.lookup(keyPath)
+	} else {
+		ival = cfg.Get(keyPath)
+	}
+
+	if ival == nil {
+		return zero, keyNotFoundError(keyPath)
+	}
+
+	if v, ok := ival.(T); ok {
+		// 容器类型返回副本，避免调用方修改共享的配置树
+		switch ival.(type) {
+		case map[string]interface{}, []interface{}:
+			return deepcopy.Copy(ival).(T), nil
+		}
+		return v, nil
+	}
+
+	if ret, handled, ok := convertScalar(ival, zero); handled {
+		if !ok {
+			return zero, newTypeError(keyPath, typeName[T](), ival, layerName)
+		}
+		return ret.(T), nil
+	}
+
+	// 其它类型通过JSON重新解析，同Remarshal
+	var ret T
+	bs, err := json.Marshal(ival)
+	if err == nil {
+		err = json.Unmarshal(bs, &ret)
+	}
+	if err != nil {
+		return zero, newTypeError(keyPath, typeName[T](), ival, layerName)
+	}
+
+	return ret, nil
+}
+
+func typeName[T any]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// convertScalar 将配置值转换为与typ相同的基础类型，handled为false表示typ不是基础类型
+func convertScalar(ival interface{}, typ interface{}) (ret interface{}, handled bool, ok bool) {
+	handled = true
+
+	switch typ.(type) {
+	case string:
+		ret, ok = toString(ival)
+	case []byte:
+		ret, ok = toBytes(ival)
+	case bool:
+		ret, ok = toBool(ival)
+	case float64:
+		ret, ok = toFloat(ival)
+	case float32:
+		f, fok := toFloat(ival)
+		ret, ok = float32(f), fok && math.Abs(f) <= math.MaxFloat32
+	case int64:
+		ret, ok = toInt(ival)
+	case int:
+		n, nok := toInt(ival)
+		ret, ok = int(n), nok && n >= math.MinInt && n <= math.MaxInt
+	case int32:
+		n, nok := toInt(ival)
+		ret, ok = int32(n), nok && n >= math.MinInt32 && n <= math.MaxInt32
+	case int16:
+		n, nok := toInt(ival)
+		ret, ok = int16(n), nok && n >= math.MinInt16 && n <= math.MaxInt16
+	case int8:
+		n, nok := toInt(ival)
+		ret, ok = int8(n), nok && n >= math.MinInt8 && n <= math.MaxInt8
+	case uint64:
+		ret, ok = toUint(ival)
+	case uint:
+		n, nok := toUint(ival)
+		ret, ok = uint(n), nok && n <= math.MaxUint
+	case uint32:
+		n, nok := toUint(ival)
+		ret, ok = uint32(n), nok && n <= math.MaxUint32
+	case uint16:
+		n, nok := toUint(ival)
+		ret, ok = uint16(n), nok && n <= math.MaxUint16
+	case uint8:
+		n, nok := toUint(ival)
+		ret, ok = uint8(n), nok && n <= math.MaxUint8
+	default:
+		handled = false
+	}
+
+	return
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValue(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := NewMapConfig(getTestConfigMap())
+
+	ast.Equal("l112_value", Value[string](cfg, "l1.l11.l112"))
+	ast.Equal(14, Value[int](cfg, "l1.l14"))
+	ast.Equal(uint8(14), Value[uint8](cfg, "l1.l14"))
+	ast.Equal(true, Value[bool](cfg, "test_conf"))
+	ast.InDelta(float32(0.12), Value[float32](cfg, "l1.l12"), 0.000001)
+	ast.Equal([]int{1, 3, 5}, Value[[]int](cfg, "l1.l11.l111.l1111"))
+	ast.Equal(testL111{L1111: []int{1, 3, 5}}, Value[testL111](cfg, "l1.l11.l111"))
+	ast.Equal(0, Value[int](cfg, "not_exist"))
+
+	// containers are copies
+	m := Value[map[string]interface{}](cfg, "l1.l11")
+	m["l112"] = "changed"
+	Value[interface{}](cfg, "l1.l11").(map[string]interface{})["l112"] = "changed"
+	ast.Equal("l112_value", cfg.String("l1.l11.l112"))
+
+	ast.Equal(6, ValueDefault(cfg, "not_exist", 6))
+	ast.Equal(0, ValueDefault(cfg, "l1.l15", 6))
+
+	_, err := ValueE[int8](cfg, "l1.l11.l112")
+	var typeErr *TypeError
+	ast.True(errors.As(err, &typeErr))
+	ast.Equal("int8", typeErr.Want)
+
+	_, err = ValueE[[]string](cfg, "not_exist")
+	ast.True(errors.Is(err, ErrKeyNotFound))
+
+	cfg.Set("big", 300)
+	_, err = ValueE[uint8](cfg, "big")
+	ast.True(errors.As(err, &typeErr))
+
+	c := newConfig()
+	c.AddLayer(DefaultLayerName, NewMapConfig(nil))
+	c.AddLayer("custom", cfg)
+	ast.Equal(14, Value[int](c.Layer("custom"), "l1.l14"))
+	_, err = ValueE[int](c.Layer("custom"), "l1.l11.l112")
+	ast.True(errors.As(err, &typeErr))
+	ast.Equal("custom", typeErr.Layer)
+}
@@ -1,6 +1,6 @@
 module github.com/techxmind/config
 
-go 1.15
+go 1.18
 
 require (
 	github.com/alicebob/miniredis/v2 v2.14.1
@@ -10,7 +10,19 @@ require (
 	github.com/stretchr/testify v1.6.1
 	github.com/techxmind/go-utils v0.0.0-20201127043211-03b94e0bd51e
 	github.com/techxmind/logger v0.0.0-20201230155601-cff8473d0220
-	go.uber.org/multierr v1.6.0 // indirect
+	go.uber.org/multierr v1.6.0
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20191220021717-ab39c6098bdb // indirect
+	go.opentelemetry.io/otel v0.15.0 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/zap v1.16.0 // indirect
+)
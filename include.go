@@ -0,0 +1,240 @@
+package config
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// IncludeKey 引用其它配置的节点，值为一个或多个Key（由同一个Asyncer获取）
+	//
+	//	{"$include": ["common.json", "db.json"], "db": {"host": "example.com"}}
+	//
+	// 被引用的配置按顺序深度合并（后面的覆盖前面的），节点自身的其它配置覆盖被引用的配置；
+	// 节点只有$include且只引用一个配置时，节点的值即为被引用的配置（可以不是map）
+	//
+	// 相对路径的Key相对于引用它的Key所在的目录，如conf/app.json中的common.json为conf/common.json；
+	// 不含/的Key（如redis的Key）原样使用。YAML中可使用!include标签：
+	//
+	//	db: !include db.yml
+	//	common: !include [a.yml, b.yml]
+	//
+	// 被引用的配置同样可以引用其它配置，形成环时加载失败；任一被引用的配置变更时，配置会重新加载。
+	// 使用了引用的异步配置不支持Set（返回ErrComposedConfig）
+	IncludeKey = "$include"
+
+	yamlIncludeTag = "!include"
+)
+
+var (
+	// ErrIncludeCycle 配置之间的引用形成了环
+	ErrIncludeCycle = errors.New("include cycle")
+)
+
+// includeResolver 加载配置树中引用的其它配置，并记录所有被引用配置的版本
+type includeResolver struct {
+	ctx     context.Context
+	asyncer AsyncerV2
+	keys    TrustedKeys
+	tags    *yamlTagOptions
+
+	deps    map[string]Version
+	loading []string
+}
+
+// resolveIncludes 加载tree中引用的配置，key为tree所在的Key，返回合并后的配置树及被引用的配置的版本，
+// keys不为空时被引用的配置需校验签名，被引用的YAML配置的标签按tags解析
+func resolveIncludes(ctx context.Context, asyncer AsyncerV2, key string, tree interface{}, keys TrustedKeys, tags *yamlTagOptions) (interface{}, map[string]Version, error) {
+	if !hasInclude(tree) {
+		return tree, nil, nil
+	}
+
+	r := &includeResolver{
+		ctx:     ctx,
+		asyncer: asyncer,
+		keys:    keys,
+		tags:    tags,
+		deps:    make(map[string]Version),
+		loading: []string{key},
+	}
+	tree, err := r.resolve(key, tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, r.deps, nil
+}
+
+func hasInclude(tree interface{}) bool {
+	switch v := tree.(type) {
+	case map[string]interface{}:
+		if _, ok := v[IncludeKey]; ok {
+			return true
+		}
+		for _, item := range v {
+			if hasInclude(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasInclude(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r *includeResolver) resolve(base string, tree interface{}) (interface{}, error) {
+	switch v := tree.(type) {
+	case map[string]interface{}:
+		includes, hasIncludes := v[IncludeKey]
+		delete(v, IncludeKey)
+		for k, item := range v {
+			val, err := r.resolve(base, item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = val
+		}
+		if !hasIncludes {
+			return v, nil
+		}
+		return r.include(base, includes, v)
+	case []interface{}:
+		for i, item := range v {
+			val, err := r.resolve(base, item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = val
+		}
+	}
+
+	return tree, nil
+}
+
+// include 依次合并引用的配置，最后合并节点自身的配置
+func (r *includeResolver) include(base string, includes interface{}, own map[string]interface{}) (interface{}, error) {
+	var keys []string
+	switch v := includes.(type) {
+	case string:
+		keys = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			key, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("invalid %s[%v] in [%s]", IncludeKey, item, base)
+			}
+			keys = append(keys, key)
+		}
+	default:
+		return nil, errors.Errorf("invalid %s[%v] in [%s]", IncludeKey, includes, base)
+	}
+
+	if len(keys) == 1 && len(own) == 0 {
+		return r.load(includeKey(base, keys[0]))
+	}
+
+	merged := make(map[string]interface{})
+	for _, key := range keys {
+		key = includeKey(base, key)
+		val, err := r.load(key)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("included config[%s] is not a map", key)
+		}
+		mergeMap(merged, m)
+	}
+	mergeMap(merged, own)
+
+	return merged, nil
+}
+
+func (r *includeResolver) load(key string) (interface{}, error) {
+	for _, k := range r.loading {
+		if k == key {
+			return nil, errors.Wrapf(ErrIncludeCycle, "%s -> %s", strings.Join(r.loading, " -> "), key)
+		}
+	}
+	r.loading = append(r.loading, key)
+	defer func() {
+		r.loading = r.loading[:len(r.loading)-1]
+	}()
+
+	content, version, err := r.asyncer.Get(r.ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "include config[%s]", key)
+	}
+	r.deps[key] = version
+
+	if len(r.keys) > 0 {
+		var sigVersion Version
+		if content, sigVersion, err = verifyContent(r.ctx, r.asyncer, key, content, r.keys); err != nil {
+			return nil, err
+		}
+		// 分离签名的变化同样需要重新加载
+		if sigVersion != "" {
+			r.deps[key+SignatureSuffix] = sigVersion
+		}
+	}
+
+	contentType := r.asyncer.ContentType(key)
+	content = processRawMessage(content, contentType)
+	val, err := unmarshalContent(content, contentType, r.tags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unmarshal included config[%s]", key)
+	}
+
+	return r.resolve(key, val)
+}
+
+// includeKey 返回相对于base的Key
+func includeKey(base, key string) string {
+	if path.IsAbs(key) || !strings.Contains(base, "/") {
+		return key
+	}
+
+	return path.Join(path.Dir(base), key)
+}
+
+// includesChanged 返回被引用的配置是否有变更（获取失败也视为变更），skip返回true的配置不检查（如支持推送的）
+func includesChanged(ctx context.Context, asyncer AsyncerV2, deps map[string]Version, skip func(key string) bool) bool {
+	for key, version := range deps {
+		if skip(key) {
+			continue
+		}
+		_, v, err := asyncer.Get(ctx, key)
+		if err != nil || v != version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// convertYAMLInclude 将!include标签的节点转换为$include节点
+func convertYAMLInclude(node *yaml.Node) {
+	value := *node
+	value.Tag = ""
+	value.Style &^= yaml.TaggedStyle
+	*node = yaml.Node{
+		Kind:   yaml.MappingNode,
+		Tag:    "!!map",
+		Line:   node.Line,
+		Column: node.Column,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: IncludeKey},
+			&value,
+		},
+	}
+}
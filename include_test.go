@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInclude(t *testing.T) {
+	ast := assert.New(t)
+
+	remote := &slowAsyncer{data: map[string][]byte{
+		"app":    []byte(`{"$include": ["common"], "name": "app", "db": {"host": "app-db"}, "list": [{"$include": "base"}]}`),
+		"common": []byte(`{"$include": "base", "db": {"host": "common-db", "port": 3306}}`),
+		"base":   []byte(`{"timeout": 3}`),
+		"c1":     []byte(`{"$include": "c2"}`),
+		"c2":     []byte(`{"$include": "c1"}`),
+	}}
+
+	cfg := NewAsyncConfig(remote, "app", time.Millisecond, false)
+	ast.Equal("app", cfg.String("name"))
+	ast.Equal("app-db", cfg.String("db.host"))
+	ast.EqualValues(3306, cfg.Int("db.port"))
+	ast.EqualValues(3, cfg.Int("timeout"))
+	ast.EqualValues(3, cfg.Int("list.0.timeout"))
+	ast.Nil(cfg.Get(IncludeKey))
+
+	// editing an indirectly included config reloads
+	remote.Set("base", []byte(`{"timeout": 5}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(5, cfg.Int("timeout"))
+	ast.EqualValues(5, cfg.Int("list.0.timeout"))
+
+	_, _, err := resolveIncludes(context.Background(), AdaptAsyncer(remote), "c1", map[string]interface{}{IncludeKey: "c2"}, nil, &yamlTagOptions{})
+	ast.True(errors.Is(err, ErrIncludeCycle), "%v", err)
+
+	// a missing include keeps the last good config
+	remote.Set("base", nil)
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(5, cfg.Int("timeout"))
+	ast.Error(cfg.Configer.(*asyncConfig).Status().LastError)
+}
+
+func TestYAMLInclude(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	ast.Nil(err)
+	defer os.RemoveAll(tmpdir)
+
+	write := func(name, content string, mtime time.Time) {
+		file := filepath.Join(tmpdir, name)
+		ast.Nil(ioutil.WriteFile(file, []byte(content), 0644))
+		ast.Nil(os.Chtimes(file, mtime, mtime))
+	}
+	now := time.Now()
+	write("app.yml", "name: app\ndb: !include db.yml\nextra: !include [a.json, b.yml]\n", now)
+	write("db.yml", "host: db1\nport: 3306\n", now)
+	write("a.json", `{"x": 1, "y": 1}`, now)
+	write("b.yml", "y: 2\n", now)
+
+	cfg := NewAsyncConfig(NewFileAsyncer(), filepath.Join(tmpdir, "app.yml"), time.Millisecond, false)
+	ast.Equal("db1", cfg.String("db.host"))
+	ast.EqualValues(1, cfg.Int("extra.x"))
+	ast.EqualValues(2, cfg.Int("extra.y"))
+
+	write("db.yml", "host: db2\n", now.Add(time.Second))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal("db2", cfg.String("db.host"))
+	ast.Nil(cfg.Get("db.port"))
+}
+
+func TestIncludeWatch(t *testing.T) {
+	ast := assert.New(t)
+
+	remote := NewMockAsyncer(true)
+	remote.Set("inc_a", []byte(`{"$include": "inc_shared", "name": "a"}`))
+	remote.Set("inc_b", []byte(`{"$include": "inc_shared", "name": "b"}`))
+	remote.Set("inc_shared", []byte(`{"v": 1}`))
+
+	cfgA := NewAsyncConfig(remote, "inc_a", 0, false)
+	defer cfgA.Close()
+	cfgB := NewAsyncConfig(remote, "inc_b", 0, false)
+	defer cfgB.Close()
+	ast.EqualValues(1, cfgA.Int("v"))
+	ast.EqualValues(1, cfgB.Int("v"))
+	ast.Equal(2, remote.watching("inc_shared"))
+
+	// every config including the key is notified
+	remote.Set("inc_shared", []byte(`{"v": 2}`))
+	ast.Eventually(func() bool { return cfgA.Int("v") == 2 }, time.Second, time.Millisecond)
+	ast.Eventually(func() bool { return cfgB.Int("v") == 2 }, time.Second, time.Millisecond)
+
+	// configs no longer including the key stop watching it
+	remote.Set("inc_a", []byte(`{"name": "a", "v": 3}`))
+	ast.Eventually(func() bool { return cfgA.Int("v") == 3 }, time.Second, time.Millisecond)
+	ast.Equal(1, remote.watching("inc_shared"))
+
+	cfgB.Close()
+	ast.Equal(0, remote.watching("inc_shared"))
+	ast.Equal(0, remote.watching("inc_b"))
+}
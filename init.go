@@ -34,6 +34,26 @@ var (
 		redisPassword   string
 		redisDefaultKey string
 		redisSubChannel string
+		redisRequired   bool
+		redisResilient  bool
+
+		// local last-known-good cache of remote config
+		cacheDir string
+
+		// deep-merge map values across layers
+		mergedView bool
+
+		// resolve ${...} references in values
+		interpolation bool
+
+		// key provider for ENC[...] values, env:NAME or file:PATH
+		keys string
+
+		// ed25519 public keys that remote config must be signed with, env:NAME or file:PATH
+		trustedKeys string
+
+		// instance attributes for conditional values, e.g. env=prod,region=eu
+		attrs string
 	}{
 		cacheTime: 3,
 	}
@@ -56,8 +76,16 @@ func init() {
 		{&_opts.redisDb, "int", "conf.redis.db", 0, "Redis db number"},
 		{&_opts.redisDefaultKey, "string", "conf.redis.default", "", "Redis default key that contains default config"},
 		{&_opts.redisSubChannel, "string", "conf.redis.channel", "", "Redis channel to subscribe value changed event"},
+		{&_opts.redisResilient, "bool", "conf.redis.resilient", false, "Fetch redis config with timeout, backoff and circuit breaking"},
+		{&_opts.redisRequired, "bool", "conf.redis.required", false, "Redis config must be loaded successfully before WaitReady returns"},
+		{&_opts.cacheDir, "string", "conf.cache_dir", "", "Local directory to keep last-known-good snapshots of remote config"},
 		{&_opts.cacheTime, "int", "conf.cache_time", 3, "Value cache time(seconds) when asyncer do not support value changed notify"},
 		{&_opts.refreshAsync, "bool", "conf.refresh_async", false, "Refresh value asynchronously or not"},
+		{&_opts.attrs, "string", "conf.attrs", "", "Instance attributes for conditional values, e.g. env=prod,region=eu,cluster=c1"},
+		{&_opts.mergedView, "bool", "conf.merged_view", false, "Deep-merge map values across layers instead of using the first layer's value"},
+		{&_opts.interpolation, "bool", "conf.interpolation", false, "Resolve ${...} references to env vars and other keys in string values"},
+		{&_opts.keys, "string", "conf.keys", "", "Keyring for ENC[...] values, env:NAME or file:PATH with id:base64key entries"},
+		{&_opts.trustedKeys, "string", "conf.trusted_keys", "", "Ed25519 public keys that redis config must be signed with, env:NAME or file:PATH with id:base64key entries"},
 	}
 
 	for _, opt := range opts {
@@ -96,6 +124,42 @@ func init() {
 		flagSet.Parse(args)
 	}
 
+	if _opts.mergedView {
+		_cfg.EnableMergedView(true)
+	}
+
+	if _opts.interpolation {
+		_cfg.EnableInterpolation(true)
+	}
+
+	if _opts.attrs != "" {
+		if attrs, ok := parseAttributes(_opts.attrs); ok {
+			SetInstanceAttributes(attrs)
+		} else {
+			logger.Errorf("invalid conf.attrs[%s]", _opts.attrs)
+		}
+	}
+
+	if _opts.keys != "" {
+		if p, err := NewKeyProvider(_opts.keys); err == nil {
+			SetKeyProvider(p)
+		} else {
+			logger.Errorf("invalid conf.keys:%v", err)
+		}
+	}
+
+	// 未能读取公钥时不能退化为不校验，不加载redis配置
+	var (
+		trustedKeys    TrustedKeys
+		trustedKeysErr error
+	)
+	if _opts.trustedKeys != "" {
+		trustedKeys, trustedKeysErr = LoadTrustedKeys(_opts.trustedKeys)
+		if trustedKeysErr != nil {
+			logger.Errorf("invalid conf.trusted_keys, redis config not loaded:%v", trustedKeysErr)
+		}
+	}
+
 	cacheTime := time.Duration(_opts.cacheTime) * time.Second
 
 	if _opts.file != "" {
@@ -107,7 +171,7 @@ func init() {
 		)
 	}
 
-	if _opts.redisAddr != "" {
+	if _opts.redisAddr != "" && trustedKeysErr == nil {
 		initWithRedis(
 			&redis.Options{
 				Addr:     _opts.redisAddr,
@@ -118,18 +182,32 @@ func init() {
 			_opts.redisDefaultKey,
 			cacheTime,
 			_opts.refreshAsync,
+			_opts.redisRequired,
+			_opts.redisResilient,
+			_opts.cacheDir,
+			trustedKeys,
 		)
 	}
 }
 
 // initWithRedis load config from redis and set it to default layer
-func initWithRedis(redisOpts *redis.Options, channel string, defaultKeys string, cacheTime time.Duration, refreshAsync bool) {
+func initWithRedis(redisOpts *redis.Options, channel string, defaultKeys string, cacheTime time.Duration, refreshAsync bool, required bool, resilient bool, cacheDir string, trustedKeys TrustedKeys) {
 	DefaultRedisAsyncer = NewRedisAsyncer(redisOpts, channel)
 
+	var asyncer Asyncer = DefaultRedisAsyncer
+	if resilient {
+		asyncer = NewResilientAsyncer(asyncer, nil)
+	}
+	if cacheDir != "" {
+		asyncer = NewCachedAsyncer(asyncer, cacheDir)
+	}
+
 	RegisterAsyner("redis", &AsyncerArgs{
-		Ins:          DefaultRedisAsyncer,
+		Ins:          asyncer,
 		CacheTime:    cacheTime,
 		RefreshAsync: refreshAsync,
+		Required:     required,
+		TrustedKeys:  trustedKeys,
 	})
 
 	if defaultKeys == "" {
@@ -137,15 +215,17 @@ func initWithRedis(redisOpts *redis.Options, channel string, defaultKeys string,
 	}
 
 	for i, key := range strings.Split(defaultKeys, ",") {
+		layerName := "default-conf-redis-" + strconv.Itoa(i)
 		redisCfg := NewAsyncConfig(
-			DefaultRedisAsyncer,
+			asyncer,
 			key,
 			cacheTime,
 			refreshAsync,
+			WithRequired(required),
+			WithTrustedKeys(trustedKeys),
 		)
 
-		layerName := "default-conf-redis-" + strconv.Itoa(i)
-		_cfg.AddLayer(layerName, redisCfg)
+		_cfg.addOwnedLayer(layerName, redisCfg)
 		AddDefaultLayerName(layerName)
 	}
 }
@@ -162,14 +242,22 @@ func initWithFile(files string, alive bool, cacheTime time.Duration, refreshAsyn
 			logger.Fatalf("conf file[%s] not found", file)
 		}
 
-		fileCfg := NewAsyncConfig(NewFileAsyncer(), file, cacheTime, refreshAsync)
+		fileCfg := NewAsyncConfig(
+			NewFileAsyncer(), file, cacheTime, refreshAsync,
+			WithRequired(true),
+		)
+
+		if rejected := fileCfg.Rejected(); rejected != nil {
+			logger.Fatalf("conf file[%s] invalid:%v", file, rejected.Err)
+		}
 
 		if !alive {
-			// 静态配置文件，直接合并至默认层，提高配置查询的性能
+			// 静态配置文件，直接合并至默认层，提高配置查询的性能，之后注册的默认层校验会校验合并后的内容
 			_cfg.Merge(fileCfg.Get(RootKey))
+			fileCfg.Close()
 		} else {
 			layerName := "default-conf-file-" + strconv.Itoa(i)
-			_cfg.AddLayer(layerName, fileCfg)
+			_cfg.addOwnedLayer(layerName, fileCfg)
 			AddDefaultLayerName(layerName)
 		}
 	}
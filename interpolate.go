@@ -0,0 +1,519 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	interpolationEnvPrefix  = "env:"
+	interpolationDefaultSep = "|"
+)
+
+var (
+	// ErrInterpolationCycle 配置值之间的引用形成了环
+	ErrInterpolationCycle = errors.New("interpolation cycle")
+)
+
+// interpolation 配置值中${...}引用的开关，默认关闭
+type interpolation struct {
+	enabled int32
+}
+
+// referenceHolder 由加载时记录配置中是否有引用的Layer实现，没有引用的Layer读取时无需遍历配置值
+type referenceHolder interface {
+	hasReferences() bool
+}
+
+// localLayer 由能够区分本地配置（配置文件、代码中设置）与远程配置的Layer实现
+// 只有本地配置中的引用可以读取环境变量，未实现的Layer视为远程配置
+type localLayer interface {
+	isLocal() bool
+}
+
+// EnableInterpolation 开启/关闭配置值中${...}引用的解析，默认关闭（启动参数conf.interpolation）
+//
+// 字符串配置值中的引用在读取时解析，引用的节点或环境变量变更后，读取到的是最新的值：
+//
+//	"dsn": "mysql://${DB_USER}:${env:DB_PASS}@${db.host}:${db.port|3306}/app"
+//
+//	${db.host}      // 引用其它节点（在同一组Layer中查找），不存在时尝试同名环境变量
+//	${env:DB_PASS}  // 只引用环境变量
+//	${db.port|3306} // 引用不存在时使用默认值
+//	$${literal}     // 转义，结果为${literal}
+//
+// 环境变量只能在本地配置（MapConfig、使用FileAsyncer的配置，见WithLocalTags）中引用，
+// 远程配置（如Redis）中的引用视为环境变量不存在，避免能够写入远程配置的人读取进程的环境变量
+//
+// 整个字符串只有一个引用时，保留被引用值的类型（如数字、map），否则按字符串拼接
+// 引用无法解析（不存在、形成环）时，该字符串保持原样，可通过Resolve获取错误
+//
+// 监听节点时，被引用的节点变更导致解析后的值变化同样会回调（在新的goroutine中执行），环境变量的变化不会触发回调
+func (cfg *defaultConfig) EnableInterpolation(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&cfg.interpolation.enabled, 1)
+	} else {
+		atomic.StoreInt32(&cfg.interpolation.enabled, 0)
+	}
+}
+
+func EnableInterpolation(enabled bool) {
+	_cfg.EnableInterpolation(enabled)
+}
+
+func (cfg *defaultConfig) interpolationEnabled() bool {
+	return atomic.LoadInt32(&cfg.interpolation.enabled) == 1
+}
+
+// layersHaveReferences 返回查找的Layer中是否可能有引用，未实现referenceHolder的Layer视为有
+func (cfg *defaultConfig) layersHaveReferences(layerNames []string) bool {
+	if len(layerNames) == 0 {
+		layerNames = cfg.defaultLayerNames.Load().([]string)
+	}
+
+	for _, name := range layerNames {
+		layer, ok := cfg.layers.Load(name)
+		if !ok {
+			continue
+		}
+		if h, ok := layer.(referenceHolder); !ok || h.hasReferences() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLocalLayer 返回Layer是否为本地配置
+func (cfg *defaultConfig) isLocalLayer(layerName string) bool {
+	layer, ok := cfg.layers.Load(layerName)
+	if !ok {
+		return false
+	}
+	l, ok := layer.(localLayer)
+
+	return ok && l.isLocal()
+}
+
+// isLocalValue 返回lookupRaw在layerName中查询到的val是否来自本地配置
+// 合并视图的map节点可能来自任一Layer，需所有Layer均为本地配置
+func (cfg *defaultConfig) isLocalValue(val interface{}, layerName string, layerNames []string) bool {
+	if _, isMap := val.(map[string]interface{}); !isMap || !cfg.mergedViewEnabled() {
+		return cfg.isLocalLayer(layerName)
+	}
+
+	if len(layerNames) == 0 {
+		layerNames = cfg.defaultLayerNames.Load().([]string)
+	}
+	for _, name := range layerNames {
+		if _, ok := cfg.layers.Load(name); ok && !cfg.isLocalLayer(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookupReference 返回引用的节点解析前的值及是否来自本地配置
+func (cfg *defaultConfig) lookupReference(layerNames []string) func(keyPath string) (interface{}, bool) {
+	return func(keyPath string) (interface{}, bool) {
+		val, layerName := cfg.lookupRaw(keyPath, layerNames...)
+		return val, cfg.isLocalValue(val, layerName, layerNames)
+	}
+}
+
+// Resolve 同Get2，同时返回解析引用时的错误，节点不存在时返回ErrKeyNotFound
+func (cfg *defaultConfig) Resolve(keyPath string, layerNames ...string) (interface{}, error) {
+	val, layerName := cfg.lookupRaw(keyPath, layerNames...)
+	if val == nil {
+		return nil, keyNotFoundError(keyPath)
+	}
+	if !cfg.interpolationEnabled() {
+		return val, nil
+	}
+
+	local := cfg.isLocalValue(val, layerName, layerNames)
+
+	return interpolate(keyPath, val, local, cfg.lookupReference(layerNames))
+}
+
+func Resolve(keyPath string, layerNames ...string) (interface{}, error) {
+	return _cfg.Resolve(keyPath, layerNames...)
+}
+
+// interpolated 返回解析引用后的值，出错的字符串保持原样，layerName为val所在的Layer
+func (cfg *defaultConfig) interpolated(keyPath string, val interface{}, layerName string, layerNames []string) interface{} {
+	if !cfg.interpolationEnabled() || !cfg.layersHaveReferences(layerNames) || !hasInterpolation(val) {
+		return val
+	}
+
+	local := cfg.isLocalValue(val, layerName, layerNames)
+	ret, _ := interpolate(keyPath, val, local, cfg.lookupReference(layerNames))
+
+	return ret
+}
+
+// watchReferences 被引用的节点变更导致keyPath解析后的值变化时回调
+// keyPath自身的变更由节点监听通知，这里只处理解析前的值不变的情况
+// 只在keyPath的值包含引用时监听所有Layer的变化，随keyPath的变更添加或取消
+func (cfg *defaultConfig) watchReferences(keyPath string, fn func(ev ChangeEvent), layerNames ...string) Subscription {
+	w := &referenceWatcher{
+		cfg:        cfg,
+		keyPath:    keyPath,
+		fn:         fn,
+		layerNames: layerNames,
+	}
+
+	// 先监听keyPath再读取当前值，避免遗漏并发的变更
+	sub := cfg.subscribe(func(_ string, layer Configer) Subscription {
+		return watchKey(layer, keyPath, func(ChangeEvent) {
+			go w.keyChanged()
+		})
+	}, layerNames...)
+	w.keyChanged()
+
+	return newSubscription(func() {
+		sub.Cancel()
+		w.cancel()
+	})
+}
+
+// referenceWatcher 监听keyPath引用的节点的变化
+// 解析需要读取其它Layer，可能触发Layer的同步刷新，因此回调在新的goroutine中执行
+type referenceWatcher struct {
+	cfg        *defaultConfig
+	keyPath    string
+	fn         func(ev ChangeEvent)
+	layerNames []string
+
+	mu        sync.Mutex
+	raw       interface{}
+	resolved  interface{}
+	layers    Subscription // keyPath的值包含引用时，对所有Layer的监听
+	cancelled bool
+}
+
+// keyChanged keyPath自身变更时更新解析前后的值，并按是否包含引用添加或取消对所有Layer的监听
+func (w *referenceWatcher) keyChanged() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelled {
+		return
+	}
+
+	raw, layerName := w.cfg.lookupRaw(w.keyPath, w.layerNames...)
+	w.raw = raw
+	w.resolved = w.cfg.interpolated(w.keyPath, raw, layerName, w.layerNames)
+
+	has := hasInterpolation(w.raw)
+	switch {
+	case has && w.layers == nil:
+		w.layers = w.cfg.subscribe(func(layerName string, layer Configer) Subscription {
+			return watchKey(layer, RootKey, func(ev ChangeEvent) {
+				go w.layerChanged(layerName, ev)
+			})
+		}, w.layerNames...)
+	case !has && w.layers != nil:
+		w.layers.Cancel()
+		w.layers = nil
+	}
+}
+
+func (w *referenceWatcher) layerChanged(layerName string, ev ChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelled {
+		return
+	}
+
+	newRaw, rawLayer := w.cfg.lookupRaw(w.keyPath, w.layerNames...)
+	if !hasInterpolation(newRaw) && !hasInterpolation(w.raw) {
+		w.raw, w.resolved = newRaw, newRaw
+		return
+	}
+
+	newResolved := w.cfg.interpolated(w.keyPath, newRaw, rawLayer, w.layerNames)
+	oldRaw, oldResolved := w.raw, w.resolved
+	w.raw, w.resolved = newRaw, newResolved
+	if !reflect.DeepEqual(oldRaw, newRaw) || reflect.DeepEqual(oldResolved, newResolved) {
+		return
+	}
+
+	layer := ev.Layer
+	if layer == "" {
+		layer = layerName
+	}
+	w.fn(ChangeEvent{
+		KeyPath:      w.keyPath,
+		OldValue:     oldResolved,
+		NewValue:     newResolved,
+		Layer:        layer,
+		ChangedPaths: ev.ChangedPaths,
+	})
+}
+
+func (w *referenceWatcher) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.cancelled = true
+	if w.layers != nil {
+		w.layers.Cancel()
+		w.layers = nil
+	}
+}
+
+// checkInterpolations 检查配置树中引用的语法，异步配置解析后调用
+func checkInterpolations(tree interface{}) error {
+	switch v := tree.(type) {
+	case string:
+		if _, err := parseTemplate(v); err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			if err := checkInterpolations(item); err != nil {
+				return errors.Wrapf(err, "key[%s]", k)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := checkInterpolations(item); err != nil {
+				return errors.Wrapf(err, "index[%d]", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasInterpolation 返回配置值中是否有需要解析的字符串
+func hasInterpolation(val interface{}) bool {
+	switch v := val.(type) {
+	case string:
+		return strings.Contains(v, "${")
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasInterpolation(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasInterpolation(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type templatePart struct {
+	literal string
+
+	// 引用，ref为空时为字面量
+	ref        string
+	env        bool
+	dft        string
+	hasDefault bool
+}
+
+// parseTemplate 解析字符串中的引用，没有引用时返回nil
+func parseTemplate(s string) ([]templatePart, error) {
+	if !strings.Contains(s, "${") {
+		return nil, nil
+	}
+
+	var (
+		parts   []templatePart
+		literal strings.Builder
+	)
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			literal.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			literal.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return nil, errors.Errorf("unclosed reference in %q", s)
+		}
+		expr := s[i+2 : i+2+end]
+		i += 2 + end + 1
+
+		part := templatePart{ref: expr}
+		if idx := strings.Index(expr, interpolationDefaultSep); idx >= 0 {
+			part.ref, part.dft, part.hasDefault = expr[:idx], expr[idx+1:], true
+		}
+		part.ref = strings.TrimSpace(part.ref)
+		if strings.HasPrefix(part.ref, interpolationEnvPrefix) {
+			part.ref, part.env = strings.TrimSpace(part.ref[len(interpolationEnvPrefix):]), true
+		}
+		if part.ref == "" {
+			return nil, errors.Errorf("empty reference in %q", s)
+		}
+
+		if literal.Len() > 0 {
+			parts = append(parts, templatePart{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, part)
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, templatePart{literal: literal.String()})
+	}
+
+	return parts, nil
+}
+
+// interpolator 解析配置值中的引用，lookup返回节点解析前的值及是否来自本地配置
+type interpolator struct {
+	lookup func(keyPath string) (interface{}, bool)
+
+	// 正在解析的节点，用于检测环
+	resolving []string
+}
+
+// interpolate 解析val中的引用，keyPath为val所在的节点，出错时对应的字符串保持原样并返回第一个错误
+// local为val是否来自本地配置，只有本地配置中的引用可以读取环境变量
+func interpolate(keyPath string, val interface{}, local bool, lookup func(keyPath string) (interface{}, bool)) (interface{}, error) {
+	in := &interpolator{
+		lookup: lookup,
+	}
+
+	return in.resolve(keyPath, val, local)
+}
+
+func (in *interpolator) resolve(keyPath string, val interface{}, local bool) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		return in.resolveString(keyPath, v, local)
+	case map[string]interface{}:
+		if !hasInterpolation(v) {
+			return v, nil
+		}
+		var err error
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			var e error
+			if m[k], e = in.resolve(joinKeyPath(keyPath, k), item, local); e != nil && err == nil {
+				err = e
+			}
+		}
+		return m, err
+	case []interface{}:
+		if !hasInterpolation(v) {
+			return v, nil
+		}
+		var err error
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			var e error
+			if items[i], e = in.resolve(joinKeyPath(keyPath, strconv.Itoa(i)), item, local); e != nil && err == nil {
+				err = e
+			}
+		}
+		return items, err
+	}
+
+	return val, nil
+}
+
+func (in *interpolator) resolveString(keyPath string, s string, local bool) (interface{}, error) {
+	parts, err := parseTemplate(s)
+	if err != nil {
+		return s, errors.Wrapf(err, "path[%s]", keyPath)
+	}
+	if parts == nil {
+		return s, nil
+	}
+
+	for _, p := range in.resolving {
+		if p == keyPath {
+			return s, errors.Wrapf(ErrInterpolationCycle, "%s -> %s", strings.Join(in.resolving, " -> "), keyPath)
+		}
+	}
+	in.resolving = append(in.resolving, keyPath)
+	defer func() {
+		in.resolving = in.resolving[:len(in.resolving)-1]
+	}()
+
+	// 整个字符串为一个引用时保留被引用值的类型
+	if len(parts) == 1 && parts[0].ref != "" {
+		val, err := in.resolveRef(parts[0], local)
+		if err != nil {
+			return s, errors.Wrapf(err, "path[%s]", keyPath)
+		}
+		return val, nil
+	}
+
+	var b strings.Builder
+	for _, part := range parts {
+		if part.ref == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		val, err := in.resolveRef(part, local)
+		if err != nil {
+			return s, errors.Wrapf(err, "path[%s]", keyPath)
+		}
+		b.WriteString(stringifyReference(val))
+	}
+
+	return b.String(), nil
+}
+
+// resolveRef 解析单个引用，local为引用所在的值是否来自本地配置
+func (in *interpolator) resolveRef(part templatePart, local bool) (interface{}, error) {
+	if !part.env {
+		if val, refLocal := in.lookup(part.ref); val != nil {
+			return in.resolve(part.ref, val, refLocal)
+		}
+	}
+
+	if local {
+		if val, ok := os.LookupEnv(part.ref); ok {
+			return val, nil
+		}
+	}
+	if part.hasDefault {
+		return part.dft, nil
+	}
+	if part.env && !local {
+		return nil, errors.Errorf("env[%s] not allowed in remote config", part.ref)
+	}
+	if part.env {
+		return nil, errors.Errorf("env[%s] not set", part.ref)
+	}
+
+	return nil, errors.Errorf("reference[%s] not found", part.ref)
+}
+
+func stringifyReference(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"sync"
+)
+
+// layerSubscription 对多个Layer的订阅
+// 未指定Layer时订阅默认Layer，之后添加的默认Layer也会自动订阅
+type layerSubscription struct {
+	mu        sync.Mutex
+	cfg       *defaultConfig
+	watch     func(layerName string, layer Configer) Subscription
+	subs      map[string]Subscription
+	layers    map[string]Configer
+	dynamic   bool
+	cancelled bool
+}
+
+func (s *layerSubscription) attach(layerName string, layer Configer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancelled || s.layers[layerName] == layer {
+		return
+	}
+	if sub, ok := s.subs[layerName]; ok {
+		sub.Cancel()
+	}
+	s.subs[layerName] = s.watch(layerName, layer)
+	s.layers[layerName] = layer
+}
+
+func (s *layerSubscription) detach(layerName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub, ok := s.subs[layerName]; ok {
+		sub.Cancel()
+		delete(s.subs, layerName)
+		delete(s.layers, layerName)
+	}
+}
+
+func (s *layerSubscription) Cancel() {
+	if s.dynamic {
+		s.cfg.subsMu.Lock()
+		delete(s.cfg.defaultSubs, s)
+		s.cfg.subsMu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelled = true
+	for name, sub := range s.subs {
+		sub.Cancel()
+		delete(s.subs, name)
+		delete(s.layers, name)
+	}
+}
+
+// subscribe 订阅指定的Layer，未指定则订阅默认Layer
+func (cfg *defaultConfig) subscribe(watch func(layerName string, layer Configer) Subscription, layerNames ...string) Subscription {
+	s := &layerSubscription{
+		cfg:     cfg,
+		watch:   watch,
+		subs:    make(map[string]Subscription),
+		layers:  make(map[string]Configer),
+		dynamic: len(layerNames) == 0,
+	}
+
+	if s.dynamic {
+		// 先登记再订阅，避免遗漏并发添加的Layer
+		cfg.subsMu.Lock()
+		cfg.defaultSubs[s] = struct{}{}
+		cfg.subsMu.Unlock()
+		layerNames = cfg.defaultLayerNames.Load().([]string)
+	}
+
+	for _, layerName := range layerNames {
+		if layer, ok := cfg.layers.Load(layerName); ok {
+			s.attach(layerName, layer.(Configer))
+		}
+	}
+
+	return s
+}
+
+func (cfg *defaultConfig) dynamicSubscriptions() []*layerSubscription {
+	cfg.subsMu.Lock()
+	defer cfg.subsMu.Unlock()
+
+	subs := make([]*layerSubscription, 0, len(cfg.defaultSubs))
+	for s := range cfg.defaultSubs {
+		subs = append(subs, s)
+	}
+
+	return subs
+}
+
+func (cfg *defaultConfig) isDefaultLayerName(layerName string) bool {
+	for _, name := range cfg.defaultLayerNames.Load().([]string) {
+		if name == layerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncDefaultSubscriptions Layer或默认Layer变更后，更新默认Layer订阅
+func (cfg *defaultConfig) syncDefaultSubscriptions(layerName string) {
+	layer, ok := cfg.layers.Load(layerName)
+	isDefault := ok && cfg.isDefaultLayerName(layerName)
+
+	for _, s := range cfg.dynamicSubscriptions() {
+		if isDefault {
+			s.attach(layerName, layer.(Configer))
+		} else {
+			s.detach(layerName)
+		}
+	}
+}
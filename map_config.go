@@ -27,10 +27,12 @@ func NewMapConfig(m map[string]interface{}, syncMode ...bool) *MapConfig {
 	}
 
 	mc := &mapConfig{
-		syncMode:  smode,
-		notifiers: make([]chan struct{}, 0),
+		syncMode: smode,
 	}
 	mc.m.Store(m)
+	if hasInterpolation(m) {
+		mc.references = 1
+	}
 
 	return &MapConfig{
 		ConfigHelper: ConfigHelper{
@@ -39,11 +41,21 @@ func NewMapConfig(m map[string]interface{}, syncMode ...bool) *MapConfig {
 	}
 }
 
+func (c *MapConfig) hasReferences() bool {
+	return c.Configer.(*mapConfig).hasReferences()
+}
+
 type mapConfig struct {
 	sync.Mutex
-	syncMode  bool
-	notifiers []chan struct{}
-	m         atomic.Value //map[string]interface{}
+	syncMode bool
+	watchers watchers
+	m        atomic.Value //map[string]interface{}
+
+	// 配置中是否可能有引用（${...}），Set包含引用的值后不再清除
+	references int32
+
+	validatorsMu sync.RWMutex
+	validators   []Validator
 }
 
 func (m *mapConfig) Get(keyPath string) interface{} {
@@ -63,16 +75,39 @@ func (m *mapConfig) Get(keyPath string) interface{} {
 //
 // 同步模式性能较低(359913 ns/op)：每次调会clone一个新的副本，并在副本上更新，替换原配置map
 func (m *mapConfig) Set(keyPath string, value interface{}) error {
+	if err := m.set(keyPath, value); err != nil {
+		return err
+	}
 
-	var newMap map[string]interface{}
+	m.watchers.dispatch()
 
+	return nil
+}
+
+func (m *mapConfig) set(keyPath string, value interface{}) error {
 	if m.syncMode {
 		m.Lock()
 		defer m.Unlock()
+	}
 
-		newMap = deepcopy.Copy(m.m.Load()).(map[string]interface{})
-	} else {
-		newMap = m.m.Load().(map[string]interface{})
+	// 有校验时在副本上更新，校验不通过时保留原配置
+	validators := m.getValidators()
+	copyOnWrite := m.syncMode || len(validators) > 0
+
+	oldMap := m.m.Load().(map[string]interface{})
+	newMap := oldMap
+	if copyOnWrite {
+		newMap = deepcopy.Copy(oldMap).(map[string]interface{})
+	}
+
+	// 有节点监听时只对比受影响的子树，直接修改原map时，需先保留子树的旧值
+	roots := m.watchers.changeRoots(keyPath, value)
+	oldSubs := make([]interface{}, len(roots))
+	for i, root := range roots {
+		oldSubs[i] = subtree(oldMap, root)
+		if !copyOnWrite {
+			oldSubs[i] = deepcopy.Copy(oldSubs[i])
+		}
 	}
 
 	if keyPath == RootKey {
@@ -87,26 +122,50 @@ func (m *mapConfig) Set(keyPath string, value interface{}) error {
 		}
 	}
 
-	if m.syncMode {
+	for _, v := range validators {
+		if err := v(newMap, oldMap); err != nil {
+			return errors.Wrap(err, "validate config")
+		}
+	}
+
+	if hasInterpolation(value) {
+		atomic.StoreInt32(&m.references, 1)
+	}
+	if copyOnWrite {
 		m.m.Store(newMap)
 	}
 
-	m.notify()
+	newSubs := make([]interface{}, len(roots))
+	for i, root := range roots {
+		newSubs[i] = subtree(newMap, root)
+	}
+	m.watchers.enqueue(func() {
+		m.watchers.notify()
+		for i, root := range roots {
+			m.watchers.notifyChangesAt(root, oldSubs[i], newSubs[i])
+		}
+	})
 
 	return nil
 }
 
-func (m *mapConfig) notify() {
-	for _, notifier := range m.notifiers {
-		select {
-		case notifier <- struct{}{}:
-		default:
-		}
-	}
+func (m *mapConfig) hasReferences() bool {
+	return atomic.LoadInt32(&m.references) == 1
+}
+
+// isLocal 由代码设置的配置为本地配置
+func (m *mapConfig) isLocal() bool {
+	return true
+}
+
+func (c *MapConfig) isLocal() bool {
+	return true
+}
+
+func (m *mapConfig) Watch(notifier chan struct{}) Subscription {
+	return m.watchers.addNotifier(notifier)
 }
 
-func (m *mapConfig) Watch(notifier chan struct{}) {
-	m.Lock()
-	defer m.Unlock()
-	m.notifiers = append(m.notifiers, notifier)
+func (m *mapConfig) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return m.watchers.addKeyWatcher(keyPath, fn)
 }
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
 
 	"gopkg.in/yaml.v3"
 )
@@ -33,8 +37,64 @@ func (m JSONMarshaler) Marshal(v interface{}) ([]byte, error) {
 	return json.Marshal(v)
 }
 
+// Unmarshal 解析JSON，解析为interface{}/map/slice时保留整数精度
+// 整数解析为int64（超出int64范围的正整数为uint64），其它数字为float64
 func (m JSONMarshaler) Unmarshal(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+	return unmarshalJSON(data, v)
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	switch v.(type) {
+	case *interface{}, *map[string]interface{}, *[]interface{}:
+	default:
+		return json.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// 与json.Unmarshal一致，不允许多余的内容
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid content after top-level value at offset %d", dec.InputOffset())
+	}
+
+	switch vv := v.(type) {
+	case *interface{}:
+		*vv = convertJSONNumbers(*vv)
+	case *map[string]interface{}:
+		convertJSONNumbers(*vv)
+	case *[]interface{}:
+		convertJSONNumbers(*vv)
+	}
+
+	return nil
+}
+
+// convertJSONNumbers 将json.Number转换为int64/uint64/float64
+func convertJSONNumbers(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case json.Number:
+		if n, err := vv.Int64(); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(vv.String(), 10, 64); err == nil {
+			return n
+		}
+		f, _ := vv.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range vv {
+			vv[k] = convertJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = convertJSONNumbers(item)
+		}
+	}
+
+	return v
 }
 
 // YAMLMarshaler
@@ -44,6 +104,42 @@ func (m YAMLMarshaler) Marshal(v interface{}) ([]byte, error) {
 	return yaml.Marshal(v)
 }
 
+// Unmarshal 解析YAML，!include标签转换为$include节点（见IncludeKey），
+// 并解析!env、!file、!base64、!secret标签（见SetSecretResolver）
+// 直接解析时data视为本地内容；异步配置中!env、!file只在本地配置中解析，见WithLocalTags
 func (m YAMLMarshaler) Unmarshal(data []byte, v interface{}) error {
-	return yaml.Unmarshal(data, v)
+	return unmarshalYAML(data, v, &yamlTagOptions{local: true})
+}
+
+func unmarshalYAML(data []byte, v interface{}, opts *yamlTagOptions) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Kind == 0 {
+		return nil
+	}
+	if err := resolveYAMLTags(&node, opts); err != nil {
+		return err
+	}
+
+	return node.Decode(v)
+}
+
+// unmarshalContent 按内容类型解析配置内容，YAML的自定义标签按opts解析
+func unmarshalContent(content []byte, contentType ContentType, opts *yamlTagOptions) (interface{}, error) {
+	var val interface{}
+	if contentType == T_YAML {
+		return val, unmarshalYAML(content, &val, opts)
+	}
+
+	marshaler, ok := typeMarshalers[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %d", contentType)
+	}
+	if err := marshaler.Unmarshal(content, &val); err != nil {
+		return nil, err
+	}
+
+	return val, nil
 }
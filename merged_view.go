@@ -0,0 +1,260 @@
+package config
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/techxmind/go-utils/object"
+)
+
+// mergedSetCacheSize 缓存的指定Layer列表合并结果的最大数量，超过时淘汰最久未使用的
+const mergedSetCacheSize = 32
+
+// mergedView 各Layer深度合并后的配置视图
+// 合并后的配置树按Layer列表缓存，任一Layer变更或Layer增删、默认Layer列表变化时全部失效
+type mergedView struct {
+	mu      sync.Mutex
+	enabled int32
+	subs    map[string]mergedLayerSub // 对各Layer根节点的监听
+
+	gen   uint64
+	cache atomic.Value //*mergedTree
+
+	// 指定Layer列表的缓存，key为以\x00连接的Layer名称
+	sets mergedLRU
+}
+
+type mergedLayerSub struct {
+	layer Configer
+	sub   Subscription
+}
+
+type mergedTree struct {
+	gen  uint64
+	tree map[string]interface{}
+}
+
+// EnableMergedView 开启/关闭合并视图模式
+//
+// 开启后，查询的节点为map时，返回按优先级深度合并所有Layer后的节点（同mergeMap规则，优先级高的值覆盖优先级低的值），
+// 而不是第一个存在该节点的Layer中的值；非map节点的查询结果不变
+//
+//	// file layer: {"db": {"host": "localhost"}}
+//	// redis layer: {"db": {"port": 3306}}
+//	cfg.Map("db") // {"host": "localhost", "port": 3306}
+func (cfg *defaultConfig) EnableMergedView(enabled bool) {
+	cfg.merged.mu.Lock()
+	defer cfg.merged.mu.Unlock()
+
+	if enabled == cfg.mergedViewEnabled() {
+		return
+	}
+
+	if enabled {
+		cfg.merged.subs = make(map[string]mergedLayerSub)
+		cfg.layers.Range(func(name, layer interface{}) bool {
+			cfg.watchMergedLayerLocked(name.(string), layer.(Configer))
+			return true
+		})
+		cfg.invalidateMergedView()
+		atomic.StoreInt32(&cfg.merged.enabled, 1)
+	} else {
+		atomic.StoreInt32(&cfg.merged.enabled, 0)
+		for _, s := range cfg.merged.subs {
+			s.sub.Cancel()
+		}
+		cfg.merged.subs = nil
+		cfg.merged.sets.clear()
+	}
+}
+
+// watchMergedLayerLocked 监听Layer的变更，使合并视图失效，需持有merged.mu
+// 节点监听在变更的goroutine中同步回调，保证变更后的查询不会读到旧的缓存
+func (cfg *defaultConfig) watchMergedLayerLocked(layerName string, layer Configer) {
+	if s, ok := cfg.merged.subs[layerName]; ok {
+		if s.layer == layer {
+			return
+		}
+		s.sub.Cancel()
+	}
+
+	cfg.merged.subs[layerName] = mergedLayerSub{
+		layer: layer,
+		sub: watchKey(layer, RootKey, func(ChangeEvent) {
+			cfg.invalidateMergedView()
+		}),
+	}
+}
+
+// syncMergedSubscriptions Layer增删后，更新对该Layer的监听
+func (cfg *defaultConfig) syncMergedSubscriptions(layerName string) {
+	cfg.merged.mu.Lock()
+	defer cfg.merged.mu.Unlock()
+
+	if cfg.merged.subs == nil {
+		return
+	}
+
+	if layer, ok := cfg.layers.Load(layerName); ok {
+		cfg.watchMergedLayerLocked(layerName, layer.(Configer))
+	} else if s, ok := cfg.merged.subs[layerName]; ok {
+		s.sub.Cancel()
+		delete(cfg.merged.subs, layerName)
+	}
+}
+
+func EnableMergedView(enabled bool) {
+	_cfg.EnableMergedView(enabled)
+}
+
+func (cfg *defaultConfig) mergedViewEnabled() bool {
+	return atomic.LoadInt32(&cfg.merged.enabled) == 1
+}
+
+func (cfg *defaultConfig) invalidateMergedView() {
+	atomic.AddUint64(&cfg.merged.gen, 1)
+}
+
+// mergedValue 返回合并后的节点值，layerNames为空时使用默认Layer
+func (cfg *defaultConfig) mergedValue(keyPath string, layerNames ...string) interface{} {
+	var tree map[string]interface{}
+	if len(layerNames) == 0 {
+		tree = cfg.mergedDefaultTree()
+	} else {
+		tree = cfg.mergedLayersTree(layerNames)
+	}
+
+	if keyPath == RootKey {
+		return tree
+	}
+
+	val, _ := object.GetValue(tree, keyPath)
+
+	return val
+}
+
+func (cfg *defaultConfig) mergedDefaultTree() map[string]interface{} {
+	gen := atomic.LoadUint64(&cfg.merged.gen)
+	if c, _ := cfg.merged.cache.Load().(*mergedTree); c != nil && c.gen == gen {
+		return c.tree
+	}
+
+	// 构建期间缓存失效时，gen不一致，下次查询会重新构建
+	tree := cfg.mergeLayers(cfg.defaultLayerNames.Load().([]string))
+	cfg.merged.cache.Store(&mergedTree{
+		gen:  gen,
+		tree: tree,
+	})
+
+	return tree
+}
+
+// mergedLayersTree 返回指定Layer列表的合并结果
+func (cfg *defaultConfig) mergedLayersTree(layerNames []string) map[string]interface{} {
+	key := strings.Join(layerNames, "\x00")
+	gen := atomic.LoadUint64(&cfg.merged.gen)
+	if c := cfg.merged.sets.get(key); c != nil && c.gen == gen {
+		return c.tree
+	}
+
+	tree := cfg.mergeLayers(layerNames)
+	if cfg.mergedViewEnabled() {
+		cfg.merged.sets.put(key, &mergedTree{
+			gen:  gen,
+			tree: tree,
+		})
+	}
+
+	return tree
+}
+
+// mergedLRU 指定Layer列表的合并结果，最多缓存mergedSetCacheSize个
+type mergedLRU struct {
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order list.List // 最近使用的在前
+}
+
+type mergedLRUEntry struct {
+	key  string
+	tree *mergedTree
+}
+
+func (c *mergedLRU) get(key string) *mergedTree {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*mergedLRUEntry).tree
+}
+
+func (c *mergedLRU) put(key string, tree *mergedTree) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*mergedLRUEntry).tree = tree
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.items == nil {
+		c.items = make(map[string]*list.Element)
+	}
+	c.items[key] = c.order.PushFront(&mergedLRUEntry{key: key, tree: tree})
+	if c.order.Len() > mergedSetCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*mergedLRUEntry).key)
+	}
+}
+
+func (c *mergedLRU) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *mergedLRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = nil
+	c.order.Init()
+}
+
+// mergeLayers 按优先级从低到高深度合并各Layer的配置
+func (cfg *defaultConfig) mergeLayers(layerNames []string) map[string]interface{} {
+	trees := make([]interface{}, 0, len(layerNames))
+	for _, name := range layerNames {
+		if layer, ok := cfg.layers.Load(name); ok {
+			trees = append(trees, layer.(Configer).Get(RootKey))
+		}
+	}
+
+	return mergeTrees(trees)
+}
+
+// mergeTrees 深度合并配置树，trees按优先级从高到低排列，非map的配置树被忽略
+func mergeTrees(trees []interface{}) map[string]interface{} {
+	tree := make(map[string]interface{})
+
+	for i := len(trees) - 1; i >= 0; i-- {
+		if m, ok := trees[i].(map[string]interface{}); ok {
+			// 复制后合并，避免修改Layer中的配置
+			mergeMap(tree, deepcopy.Copy(m).(map[string]interface{}))
+		}
+	}
+
+	return tree
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergedView(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	fileLayer := NewMapConfig(map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"opts": map[string]interface{}{"timeout": 1},
+		},
+	})
+	cfg.AddLayer(DefaultLayerName, fileLayer)
+
+	key := "merged_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db":{"port":3306,"opts":{"retry":2}}}`),
+	}}
+	cfg.AddLayer("remote", NewAsyncConfig(remote, key, time.Millisecond, false))
+	cfg.AddDefaultLayerName("remote")
+
+	// first-non-nil lookup hides sibling keys
+	ast.Nil(cfg.Map("db").Get("host"))
+
+	cfg.EnableMergedView(true)
+	db := cfg.Map("db")
+	ast.Equal("localhost", db.String("host"))
+	ast.EqualValues(3306, db.Int("port"))
+	ast.EqualValues(1, db.Int("opts.timeout"))
+	ast.EqualValues(2, db.Int("opts.retry"))
+	ast.EqualValues(2, cfg.Int("db.opts.retry"), "scalar lookup unchanged")
+	ast.Equal("localhost", cfg.String("db.host"))
+
+	// layers are not modified by merging
+	_, ok := fileLayer.Get("db.port").(int64)
+	ast.False(ok)
+
+	// invalidated on layer change
+	ast.Nil(fileLayer.Set("db.user", "root"))
+	ast.Equal("root", cfg.Map("db").String("user"))
+
+	remote.Set(key, []byte(`{"db":{"port":3307}}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(3307, cfg.Int("db.port"))
+	ast.EqualValues(3307, cfg.Map("db").Int("port"))
+	ast.Nil(cfg.Map("db").Get("opts.retry"))
+
+	// invalidated on default layer change
+	cfg.RemoveDefaultLayerName("remote")
+	ast.Nil(cfg.Map("db").Get("port"))
+
+	// explicit layers are merged too
+	ast.EqualValues(3307, cfg.Layer("remote", DefaultLayerName).Map("db").Int("port"))
+	ast.Equal("root", cfg.Layer("remote", DefaultLayerName).Map("db").String("user"))
+
+	// explicit layers are cached per layer set
+	tree := cfg.mergedValue(RootKey, "remote", DefaultLayerName)
+	ast.Equal(reflect.ValueOf(tree).Pointer(), reflect.ValueOf(cfg.mergedValue(RootKey, "remote", DefaultLayerName)).Pointer())
+
+	// layers without KeyWatcher are invalidated by Set before it returns
+	plain := struct{ Configer }{NewMapConfig(map[string]interface{}{"db": map[string]interface{}{"pool": 1}})}
+	cfg.AddLayer("plain", plain)
+	ast.EqualValues(1, cfg.Layer("plain", DefaultLayerName).Map("db").Int("pool"))
+	ast.Nil(cfg.Set2("db.pool", 2, "plain"))
+	ast.EqualValues(2, cfg.Layer("plain", DefaultLayerName).Map("db").Int("pool"))
+
+	// layers added after the layer set is cached are watched too
+	ast.Nil(cfg.Layer("late", DefaultLayerName).Map("db").Get("pool"))
+	late := NewMapConfig(map[string]interface{}{"db": map[string]interface{}{"pool": 3}})
+	cfg.AddLayer("late", late)
+	ast.EqualValues(3, cfg.Layer("late", DefaultLayerName).Map("db").Int("pool"))
+	ast.Nil(late.Set("db.pool", 4))
+	ast.EqualValues(4, cfg.Layer("late", DefaultLayerName).Map("db").Int("pool"))
+
+	// per request layer lists are bounded and share one watcher per layer
+	for i := 0; i < 2*mergedSetCacheSize; i++ {
+		name := fmt.Sprintf("tenant-%d", i)
+		cfg.AddLayer(name, NewMapConfig(map[string]interface{}{"db": map[string]interface{}{"tenant": i}}))
+		ast.EqualValues(i, cfg.Layer(name, DefaultLayerName).Map("db").Int("tenant"))
+		cfg.RemoveLayer(name)
+	}
+	ast.Equal(mergedSetCacheSize, cfg.merged.sets.len())
+	ast.Len(cfg.merged.subs, 4)
+
+	cfg.EnableMergedView(false)
+	ast.Nil(cfg.Layer("remote", DefaultLayerName).Map("db").Get("user"))
+	ast.Equal(0, cfg.merged.sets.len())
+}
@@ -36,10 +36,18 @@ func (p *layerConfigProxy) Get(keyPath string) (val interface{}) {
 	return p.cfg.Get2(keyPath, p.layerNames...)
 }
 
+func (p *layerConfigProxy) lookup(keyPath string) (interface{}, string) {
+	return p.cfg.lookup2(keyPath, p.layerNames...)
+}
+
 func (p *layerConfigProxy) Set(keyPath string, value interface{}) error {
 	return p.cfg.Set2(keyPath, value, p.layerNames...)
 }
 
-func (p *layerConfigProxy) Watch(notifier chan struct{}) {
-	p.cfg.Watch2(notifier, p.layerNames...)
+func (p *layerConfigProxy) Watch(notifier chan struct{}) Subscription {
+	return p.cfg.Watch2(notifier, p.layerNames...)
+}
+
+func (p *layerConfigProxy) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return p.cfg.WatchKey2(keyPath, fn, p.layerNames...)
 }
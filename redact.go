@@ -0,0 +1,200 @@
+package config
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactMask 敏感值在Dump、JSONRedacted、DumpAnnotated及日志中的替换值
+const RedactMask = "******"
+
+// minTrackedSecretLen 长度小于该值的已解密值只整值匹配，不在其它字符串中替换，避免误伤
+const minTrackedSecretLen = 4
+
+var (
+	_secretsMu sync.RWMutex
+	// 默认的敏感Key模式，匹配完整路径（不区分大小写）
+	_secretPatterns = []string{"*password*", "*passwd*", "*secret*", "*token*", "private_key", "*.private_key", "access_key", "*.access_key"}
+	_secretSchemas  []secretSchema
+	// 已解密的值，按配置对象记录，每次加载时替换
+	// 这些值无论出现在哪个节点（包括插值后的字符串中）都会被掩码
+	_trackedSecrets = make(map[interface{}][]string)
+	_secretValues   map[string]struct{}
+	_secretReplacer *strings.Replacer
+)
+
+type secretSchema struct {
+	schema  *Schema
+	keyPath string
+}
+
+// AddSecretPattern 添加敏感Key模式，语法同path.Match，匹配完整路径（不区分大小写）
+//
+//	config.AddSecretPattern("*.dsn", "payment.*")
+func AddSecretPattern(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	_secretsMu.Lock()
+	defer _secretsMu.Unlock()
+	for _, pattern := range patterns {
+		_secretPatterns = append(_secretPatterns, strings.ToLower(pattern))
+	}
+
+	return nil
+}
+
+// AddSecretSchema 将Schema中标注为 "secret": true 或 "writeOnly": true 的节点视为敏感值，keyPath为Schema对应的节点
+func AddSecretSchema(s *Schema, keyPath string) {
+	_secretsMu.Lock()
+	defer _secretsMu.Unlock()
+	_secretSchemas = append(_secretSchemas, secretSchema{schema: s, keyPath: keyPath})
+}
+
+// trackSecrets 替换owner（配置对象）已解密的值，secrets为空时移除
+func trackSecrets(owner interface{}, secrets []string) {
+	_secretsMu.Lock()
+	defer _secretsMu.Unlock()
+
+	if len(secrets) == 0 {
+		if _, ok := _trackedSecrets[owner]; !ok {
+			return
+		}
+		delete(_trackedSecrets, owner)
+	} else {
+		_trackedSecrets[owner] = secrets
+	}
+
+	values := make(map[string]struct{})
+	var long []string
+	for _, items := range _trackedSecrets {
+		for _, secret := range items {
+			if _, ok := values[secret]; ok || secret == "" {
+				continue
+			}
+			values[secret] = struct{}{}
+			if len(secret) >= minTrackedSecretLen {
+				long = append(long, secret)
+			}
+		}
+	}
+
+	// 较长的值优先匹配，避免只替换了其中的一部分
+	sort.Slice(long, func(i, j int) bool {
+		return len(long[i]) > len(long[j])
+	})
+	var replacer *strings.Replacer
+	if len(long) > 0 {
+		pairs := make([]string, 0, 2*len(long))
+		for _, secret := range long {
+			pairs = append(pairs, secret, RedactMask)
+		}
+		replacer = strings.NewReplacer(pairs...)
+	}
+
+	_secretValues = values
+	_secretReplacer = replacer
+}
+
+// IsSecret 返回指定节点是否被标记为敏感值（Key模式或Schema标注）
+func IsSecret(keyPath string) bool {
+	_secretsMu.RLock()
+	defer _secretsMu.RUnlock()
+	return isSecretLocked(keyPath)
+}
+
+func isSecretLocked(keyPath string) bool {
+	if keyPath == RootKey {
+		return false
+	}
+
+	lower := strings.ToLower(keyPath)
+	for _, pattern := range _secretPatterns {
+		if ok, _ := path.Match(pattern, lower); ok {
+			return true
+		}
+	}
+
+	for _, ss := range _secretSchemas {
+		var rel []string
+		switch {
+		case ss.keyPath == RootKey:
+			rel = strings.Split(keyPath, ".")
+		case strings.HasPrefix(keyPath, ss.keyPath+"."):
+			rel = strings.Split(keyPath[len(ss.keyPath)+1:], ".")
+		case keyPath == ss.keyPath:
+		default:
+			continue
+		}
+		if ss.schema.secretAt(rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact 返回掩码敏感值后的副本，keyPath为val所在的节点，val本身不被修改
+func Redact(keyPath string, val interface{}) interface{} {
+	_secretsMu.RLock()
+	defer _secretsMu.RUnlock()
+	return redactLocked(keyPath, val)
+}
+
+func redactLocked(keyPath string, val interface{}) interface{} {
+	if val != nil && isSecretLocked(keyPath) {
+		return RedactMask
+	}
+
+	switch v := val.(type) {
+	case string:
+		return redactString(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = redactLocked(joinKeyPath(keyPath, k), item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = redactLocked(joinKeyPath(keyPath, strconv.Itoa(i)), item)
+		}
+		return s
+	}
+
+	return val
+}
+
+// redactString 替换字符串中已解密的值
+func redactString(s string) string {
+	if _, ok := _secretValues[s]; ok {
+		return RedactMask
+	}
+	if _secretReplacer != nil {
+		return _secretReplacer.Replace(s)
+	}
+
+	return s
+}
+
+// redactContent 返回掩码敏感值后的配置内容，用于日志；不解析YAML标签，无法解析时只输出长度
+func redactContent(content []byte, contentType ContentType) string {
+	tree, err := parseContent(content, contentType, &yamlTagOptions{raw: true})
+	if err != nil {
+		return "<" + strconv.Itoa(len(content)) + " bytes>"
+	}
+
+	data, err := typeMarshalers[contentType].Marshal(Redact(RootKey, tree))
+	if err != nil {
+		return "<" + strconv.Itoa(len(content)) + " bytes>"
+	}
+
+	return string(data)
+}
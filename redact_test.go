@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.True(IsSecret("db.password"))
+	ast.True(IsSecret("oauth.Client_Secret"))
+	ast.False(IsSecret("db.host"))
+	ast.False(IsSecret(RootKey))
+
+	ast.Error(AddSecretPattern("["))
+	ast.Nil(AddSecretPattern("redact_test.*.dsn"))
+	ast.True(IsSecret("redact_test.main.dsn"))
+	ast.False(IsSecret("redact_test.dsn"))
+
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"servers": {"items": {"properties": {"auth": {"type": "string", "writeOnly": true}}}},
+			"keys": {"additionalProperties": {"secret": true}},
+			"name": {"type": "string"}
+		}
+	}`), T_JSON)
+	ast.Nil(err)
+	AddSecretSchema(schema, "redact_schema")
+	ast.True(IsSecret("redact_schema.servers.0.auth"))
+	ast.True(IsSecret("redact_schema.keys.a"))
+	ast.True(IsSecret("redact_schema.keys.a.b"))
+	ast.False(IsSecret("redact_schema.name"))
+	ast.False(IsSecret("redact_schema.servers.0"))
+
+	_, err = ParseSchema([]byte(`{"secret": "yes"}`), T_JSON)
+	ast.Error(err)
+
+	val := map[string]interface{}{
+		"user":     "root",
+		"password": "p@ss",
+		"servers":  []interface{}{map[string]interface{}{"auth": "x", "port": int64(1)}},
+	}
+	ast.Equal(map[string]interface{}{
+		"user":     "root",
+		"password": RedactMask,
+		"servers":  []interface{}{map[string]interface{}{"auth": RedactMask, "port": int64(1)}},
+	}, Redact("redact_schema", val))
+	// source is not modified
+	ast.Equal("p@ss", val["password"])
+}
+
+func TestRedactDecrypted(t *testing.T) {
+	ast := assert.New(t)
+
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{2}, 32)})
+	ast.Nil(err)
+	encrypted, err := EncryptValue(keyring, "hunter2")
+	ast.Nil(err)
+	SetKeyProvider(keyring)
+	defer SetKeyProvider(nil)
+
+	key := "redact_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db": {"pass": "` + encrypted + `", "dsn": "mysql://root:${db.pass}@db"}, "ttl": 3}`),
+	}}
+	cfg := NewAsyncConfig(remote, key, 0, false)
+	defer cfg.Close()
+	ast.Equal("hunter2", cfg.String("db.pass"))
+
+	c := newConfig()
+	c.EnableInterpolation(true)
+	c.AddLayer(DefaultLayerName, cfg)
+
+	// interpolated values containing the decrypted value are masked too
+	ast.Equal("mysql://root:hunter2@db", c.String("db.dsn"))
+	data, err := c.JSONRedacted("db")
+	ast.Nil(err)
+	ast.JSONEq(`{"pass": "******", "dsn": "mysql://root:******@db"}`, string(data))
+
+	data, err = cfg.JSON("db.pass")
+	ast.Nil(err)
+	ast.Equal(`"hunter2"`, string(data))
+
+	ast.Equal(`{"a":"******","b":1}`, redactContent([]byte(`{"a":"hunter2","b":1}`), T_JSON))
+	ast.Equal("<3 bytes>", redactContent([]byte(`{"a`), T_JSON))
+
+	ex := c.Explain("db.pass").Redacted()
+	ast.Equal(RedactMask, ex.Value)
+	ast.Equal(RedactMask, ex.Winner.Value)
+	ast.Equal("hunter2", c.Explain("db.pass").Value)
+	lines := c.annotate("db.pass")
+	ast.Len(lines, 1)
+	ast.Regexp(`^db\.pass = "\*{6}" # layer=default source=redact_key`, lines[0])
+}
+
+func TestTrackedSecretsPerLoad(t *testing.T) {
+	ast := assert.New(t)
+
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{2}, 32)})
+	ast.Nil(err)
+	SetKeyProvider(keyring)
+	defer SetKeyProvider(nil)
+
+	encrypt := func(s string) string {
+		encrypted, err := EncryptValue(keyring, s)
+		ast.Nil(err)
+		return encrypted
+	}
+
+	key := "tracked_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"a": "` + encrypt("old-secret") + `", "b": "` + encrypt("old-secret-2") + `"}`),
+	}}
+	cfg := NewAsyncConfig(remote, key, time.Millisecond, false)
+	ast.Equal("x ****** y", Redact(RootKey, "x old-secret-2 y"))
+
+	// rotated secrets replace the previous ones of the config
+	remote.Set(key, []byte(`{"a": "`+encrypt("new-secret")+`"}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal("new-secret", cfg.String("a"))
+	ast.Equal("old-secret ******", Redact(RootKey, "old-secret new-secret"))
+
+	cfg.Close()
+	ast.Equal("new-secret", Redact(RootKey, "new-secret"))
+}
+
+func TestRedactErrors(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.True(IsSecret("private_key"))
+	ast.True(IsSecret("aws.access_key"))
+	ast.True(IsSecret("access_key"))
+
+	schema, err := ParseSchema([]byte(`{"properties": {
+		"password": {"type": "string", "pattern": "^[a-z]{10}$"},
+		"api_token": {"enum": ["a", "b"]},
+		"port": {"type": "integer", "minimum": 1}
+	}}`), T_JSON)
+	ast.Nil(err)
+	err = schema.Validate(map[string]interface{}{"password": "hunter2", "api_token": "t0k3n", "port": int64(0)})
+	ast.NotContains(err.Error(), "hunter2")
+	ast.NotContains(err.Error(), "t0k3n")
+	ast.Contains(err.Error(), `path[password] value "******" not match pattern`)
+	ast.Contains(err.Error(), "path[port] value 0 less than minimum 1")
+
+	ast.Equal("string(******)", newTypeError("db.password", "int", "hunter2", "").Got)
+	ast.Equal("string(abc)", newTypeError("db.user", "int", "abc", "").Got)
+
+	// rejected content is redacted too
+	key := "redact_reject_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"password":"hunter2","port":0}`),
+	}}
+	cfg := NewAsyncConfig(remote, key, 0, false, WithValidator(SchemaValidator(schema, RootKey)))
+	defer cfg.Close()
+	rejected := cfg.Rejected()
+	if ast.NotNil(rejected) {
+		ast.Equal(`{"password":"******","port":0}`, string(rejected.Content))
+		ast.NotContains(rejected.Err.Error(), "hunter2")
+	}
+}
@@ -0,0 +1,470 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/techxmind/go-utils/object"
+)
+
+// Schema JSON Schema (draft 2020-12) 的子集，用于校验配置树
+//
+// 支持的关键字：type、enum、const、properties、required、additionalProperties、items、
+// minimum、maximum、exclusiveMinimum、exclusiveMaximum、minLength、maxLength、pattern、minItems、maxItems，
+// 其它关键字被忽略。"secret": true 或 "writeOnly": true 标注敏感值，见AddSecretSchema
+type Schema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	noAdditional         bool
+	items                *Schema
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minItems             *int
+	maxItems             *int
+	secret               bool
+}
+
+// SchemaError 配置不符合Schema，KeyPath为出错节点的完整路径，数组元素以下标表示，如 servers.0.port
+// Message中的敏感值（见IsSecret）已掩码
+type SchemaError struct {
+	KeyPath string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("path[%s] %s", e.KeyPath, e.Message)
+}
+
+// SchemaErrors 返回Validate错误中的所有SchemaError
+func SchemaErrors(err error) []*SchemaError {
+	var errs []*SchemaError
+	for _, e := range multierr.Errors(err) {
+		if se, ok := e.(*SchemaError); ok {
+			errs = append(errs, se)
+		}
+	}
+
+	return errs
+}
+
+// ParseSchema 解析JSON或YAML格式的Schema
+func ParseSchema(content []byte, contentType ContentType) (*Schema, error) {
+	tree, err := ParseContent(content, contentType)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse schema")
+	}
+
+	return NewSchema(tree)
+}
+
+// NewSchema 由已解析的Schema树创建Schema
+func NewSchema(tree interface{}) (*Schema, error) {
+	return newSchema(tree, "#")
+}
+
+func newSchema(tree interface{}, ref string) (*Schema, error) {
+	s := &Schema{}
+
+	switch v := tree.(type) {
+	case bool:
+		// true 允许任意值，false 不允许任何值
+		if !v {
+			s.types = []string{}
+		}
+		return s, nil
+	case map[string]interface{}:
+		return s, s.parse(v, ref)
+	}
+
+	return nil, errors.Errorf("schema[%s] is not an object", ref)
+}
+
+func (s *Schema) parse(m map[string]interface{}, ref string) (err error) {
+	if t, ok := m["type"]; ok {
+		switch v := t.(type) {
+		case string:
+			s.types = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				name, ok := item.(string)
+				if !ok {
+					return errors.Errorf("schema[%s/type] invalid type", ref)
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return errors.Errorf("schema[%s/type] invalid type", ref)
+		}
+		for _, name := range s.types {
+			if !isSchemaType(name) {
+				return errors.Errorf("schema[%s/type] unknown type %s", ref, name)
+			}
+		}
+	}
+
+	if v, ok := m["enum"]; ok {
+		if s.enum, ok = v.([]interface{}); !ok {
+			return errors.Errorf("schema[%s/enum] is not an array", ref)
+		}
+	}
+	s.constValue, s.hasConst = m["const"]
+
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("schema[%s/properties] is not an object", ref)
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, prop := range props {
+			if s.properties[name], err = newSchema(prop, ref+"/properties/"+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v, ok := m["required"]; ok {
+		items, ok := v.([]interface{})
+		if !ok {
+			return errors.Errorf("schema[%s/required] is not an array", ref)
+		}
+		for _, item := range items {
+			name, ok := item.(string)
+			if !ok {
+				return errors.Errorf("schema[%s/required] invalid property name", ref)
+			}
+			s.required = append(s.required, name)
+		}
+	}
+
+	if v, ok := m["additionalProperties"]; ok {
+		if b, ok := v.(bool); ok {
+			s.noAdditional = !b
+		} else if s.additionalProperties, err = newSchema(v, ref+"/additionalProperties"); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := m["items"]; ok {
+		if s.items, err = newSchema(v, ref+"/items"); err != nil {
+			return err
+		}
+	}
+
+	for name, dst := range map[string]**float64{
+		"minimum":          &s.minimum,
+		"maximum":          &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum,
+		"exclusiveMaximum": &s.exclusiveMaximum,
+	} {
+		if v, ok := m[name]; ok {
+			f, ok := schemaNumber(v)
+			if !ok {
+				return errors.Errorf("schema[%s/%s] is not a number", ref, name)
+			}
+			*dst = &f
+		}
+	}
+
+	for name, dst := range map[string]**int{
+		"minLength": &s.minLength,
+		"maxLength": &s.maxLength,
+		"minItems":  &s.minItems,
+		"maxItems":  &s.maxItems,
+	} {
+		if v, ok := m[name]; ok {
+			f, ok := schemaNumber(v)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return errors.Errorf("schema[%s/%s] is not a non-negative integer", ref, name)
+			}
+			n := int(f)
+			*dst = &n
+		}
+	}
+
+	for _, name := range []string{"secret", "writeOnly"} {
+		if v, ok := m[name]; ok {
+			b, ok := v.(bool)
+			if !ok {
+				return errors.Errorf("schema[%s/%s] is not a boolean", ref, name)
+			}
+			s.secret = s.secret || b
+		}
+	}
+
+	if v, ok := m["pattern"]; ok {
+		pattern, ok := v.(string)
+		if !ok {
+			return errors.Errorf("schema[%s/pattern] is not a string", ref)
+		}
+		if s.pattern, err = regexp.Compile(pattern); err != nil {
+			return errors.Wrapf(err, "schema[%s/pattern]", ref)
+		}
+	}
+
+	return nil
+}
+
+// Validate 校验配置树，返回所有不符合的节点（可通过SchemaErrors获取）
+func (s *Schema) Validate(tree interface{}) error {
+	return s.validate(tree, RootKey, nil)
+}
+
+func (s *Schema) validate(v interface{}, keyPath string, errs error) error {
+	fail := func(format string, args ...interface{}) {
+		errs = multierr.Append(errs, &SchemaError{
+			KeyPath: keyPath,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// 错误信息中的值，敏感值被掩码
+	shown := func() interface{} {
+		return Redact(keyPath, v)
+	}
+
+	typ := schemaTypeOf(v)
+	if s.types != nil && len(s.types) == 0 {
+		fail("value not allowed")
+		return errs
+	}
+	if s.types != nil && !s.matchType(v, typ) {
+		fail("expect %s, got %s", strings.Join(s.types, " or "), typ)
+		return errs
+	}
+
+	if s.enum != nil {
+		matched := false
+		for _, item := range s.enum {
+			if schemaEqual(v, item) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value %v not in enum %v", shown(), Redact(keyPath, s.enum))
+		}
+	}
+	if s.hasConst && !schemaEqual(v, s.constValue) {
+		fail("value %v not equal to const %v", shown(), Redact(keyPath, s.constValue))
+	}
+
+	switch typ {
+	case "number", "integer":
+		f, _ := schemaNumber(v)
+		if s.minimum != nil && f < *s.minimum {
+			fail("value %v less than minimum %v", shown(), *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("value %v greater than maximum %v", shown(), *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+			fail("value %v not greater than exclusiveMinimum %v", shown(), *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+			fail("value %v not less than exclusiveMaximum %v", shown(), *s.exclusiveMaximum)
+		}
+
+	case "string":
+		str := v.(string)
+		n := utf8.RuneCountInString(str)
+		if s.minLength != nil && n < *s.minLength {
+			fail("length %d less than minLength %d", n, *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("length %d greater than maxLength %d", n, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			fail("value %q not match pattern %s", shown(), s.pattern)
+		}
+
+	case "array":
+		items := v.([]interface{})
+		if s.minItems != nil && len(items) < *s.minItems {
+			fail("items %d less than minItems %d", len(items), *s.minItems)
+		}
+		if s.maxItems != nil && len(items) > *s.maxItems {
+			fail("items %d greater than maxItems %d", len(items), *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range items {
+				errs = s.items.validate(item, joinKeyPath(keyPath, strconv.Itoa(i)), errs)
+			}
+		}
+
+	case "object":
+		m := v.(map[string]interface{})
+		for _, name := range s.required {
+			if _, ok := m[name]; !ok {
+				errs = multierr.Append(errs, &SchemaError{
+					KeyPath: joinKeyPath(keyPath, name),
+					Message: "required",
+				})
+			}
+		}
+
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			childPath := joinKeyPath(keyPath, name)
+			if prop, ok := s.properties[name]; ok {
+				errs = prop.validate(m[name], childPath, errs)
+			} else if s.noAdditional {
+				errs = multierr.Append(errs, &SchemaError{
+					KeyPath: childPath,
+					Message: "additional property not allowed",
+				})
+			} else if s.additionalProperties != nil {
+				errs = s.additionalProperties.validate(m[name], childPath, errs)
+			}
+		}
+	}
+
+	return errs
+}
+
+func (s *Schema) matchType(v interface{}, typ string) bool {
+	for _, name := range s.types {
+		if name == typ || (name == "number" && typ == "integer") {
+			return true
+		}
+		// 1.0 同样视为integer
+		if name == "integer" && typ == "number" {
+			if f, _ := schemaNumber(v); f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SchemaValidator 返回使用Schema校验keyPath节点的Validator，keyPath为RootKey时校验整个配置
+// 错误中的路径为完整路径，keyPath节点不存在时返回required错误
+func SchemaValidator(s *Schema, keyPath string) Validator {
+	return func(newTree, oldTree interface{}) error {
+		node := newTree
+		if keyPath != RootKey {
+			var ok bool
+			if node, ok = object.GetValue(newTree, keyPath); !ok {
+				return &SchemaError{KeyPath: keyPath, Message: "required"}
+			}
+		}
+
+		return s.validate(node, keyPath, nil)
+	}
+}
+
+// AddSchema 使用Schema校验Layer中keyPath节点，keyPath为RootKey时校验整个配置，见AddValidator
+func (cfg *defaultConfig) AddSchema(layerName string, keyPath string, s *Schema) error {
+	return cfg.AddValidator(layerName, SchemaValidator(s, keyPath))
+}
+
+func AddSchema(layerName string, keyPath string, s *Schema) error {
+	return _cfg.AddSchema(layerName, keyPath, s)
+}
+
+// secretAt 返回相对路径path处的节点是否被标注为敏感值（祖先节点被标注时也视为敏感值）
+func (s *Schema) secretAt(path []string) bool {
+	for _, key := range path {
+		if s.secret {
+			return true
+		}
+		var next *Schema
+		if prop, ok := s.properties[key]; ok {
+			next = prop
+		} else if _, err := strconv.Atoi(key); err == nil && s.items != nil {
+			next = s.items
+		} else {
+			next = s.additionalProperties
+		}
+		if next == nil {
+			return false
+		}
+		s = next
+	}
+
+	return s.secret
+}
+
+func isSchemaType(name string) bool {
+	switch name {
+	case "null", "boolean", "object", "array", "number", "integer", "string":
+		return true
+	}
+
+	return false
+}
+
+func schemaTypeOf(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number:
+		if _, err := vv.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case float32, float64:
+		return "number"
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// schemaNumber 仅转换数值类型，字符串等返回false
+func schemaNumber(v interface{}) (float64, bool) {
+	switch schemaTypeOf(v) {
+	case "number", "integer":
+		return toFloat(v)
+	}
+
+	return 0, false
+}
+
+func schemaEqual(a, b interface{}) bool {
+	fa, aok := schemaNumber(a)
+	fb, bok := schemaNumber(b)
+	if aok || bok {
+		return aok && bok && fa == fb
+	}
+
+	return reflect.DeepEqual(a, b)
+}
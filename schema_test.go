@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `
+{
+	"type": "object",
+	"required": ["db"],
+	"additionalProperties": false,
+	"properties": {
+		"db": {
+			"type": "object",
+			"required": ["host", "port"],
+			"properties": {
+				"host": {"type": "string", "minLength": 1, "pattern": "^[a-z.]+$"},
+				"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+				"mode": {"enum": ["rw", "ro"]}
+			}
+		},
+		"ratio": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+		"extra": {"type": ["object", "null"], "additionalProperties": {"type": "boolean"}}
+	}
+}
+`
+
+func TestSchema(t *testing.T) {
+	ast := assert.New(t)
+
+	schema, err := ParseSchema([]byte(testSchema), T_JSON)
+	ast.Nil(err)
+
+	tests := []struct {
+		content string
+		errs    []string
+	}{
+		{`{"db":{"host":"example.com","port":3306,"mode":"ro"},"ratio":0.5,"tags":["a"],"extra":{"x":true}}`, nil},
+		{`{"db":{"host":"example.com","port":3306.0},"extra":null}`, nil},
+		{`{}`, []string{"path[db] required"}},
+		{`{"db":{"host":"","port":"3306"}}`, []string{
+			"path[db.host] length 0 less than minLength 1",
+			"path[db.host] value \"\" not match pattern ^[a-z.]+$",
+			"path[db.port] expect integer, got string",
+		}},
+		{`{"db":{"host":"a","port":70000,"mode":"w"},"ratio":1,"tags":["a",1,"c"],"extra":{"x":1},"other":1}`, []string{
+			"path[db.mode] value w not in enum [rw ro]",
+			"path[db.port] value 70000 greater than maximum 65535",
+			"path[extra.x] expect boolean, got integer",
+			"path[other] additional property not allowed",
+			"path[ratio] value 1 not less than exclusiveMaximum 1",
+			"path[tags] items 3 greater than maxItems 2",
+			"path[tags.1] expect string, got integer",
+		}},
+	}
+
+	for _, test := range tests {
+		tree, err := ParseContent([]byte(test.content), T_JSON)
+		ast.Nil(err)
+
+		var errs []string
+		for _, e := range SchemaErrors(schema.Validate(tree)) {
+			errs = append(errs, e.Error())
+		}
+		ast.Equal(test.errs, errs, test.content)
+	}
+
+	// yaml content and yaml schema
+	schema, err = ParseSchema([]byte("type: object\nproperties:\n  port: {type: integer, minimum: 1}\n"), T_YAML)
+	ast.Nil(err)
+	tree, _ := ParseContent([]byte("port: 0\n"), T_YAML)
+	ast.Equal("path[port] value 0 less than minimum 1", schema.Validate(tree).Error())
+
+	_, err = ParseSchema([]byte(`{"type":"unknown"}`), T_JSON)
+	ast.NotNil(err)
+	_, err = ParseSchema([]byte(`{"pattern":"("}`), T_JSON)
+	ast.NotNil(err)
+}
+
+func TestSchemaValidator(t *testing.T) {
+	ast := assert.New(t)
+
+	schema, err := ParseSchema([]byte(`{"type":"object","properties":{"port":{"type":"integer","minimum":1}}}`), T_JSON)
+	ast.Nil(err)
+
+	key := "schema_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db":{"port":0}}`),
+	}}
+
+	// validate on load
+	cfg := NewAsyncConfig(remote, key, 0, false, WithValidator(SchemaValidator(schema, "db")))
+	ast.False(cfg.Status().Ready)
+	ast.Contains(cfg.Rejected().Err.Error(), "path[db.port] value 0 less than minimum 1")
+	cfg.Close()
+
+	// validate on set
+	remote.Set(key, []byte(`{"db":{"port":80}}`))
+	cfg = NewAsyncConfig(remote, key, 0, false, WithValidator(SchemaValidator(schema, "db")))
+	ast.EqualValues(80, cfg.Int("db.port"))
+	err = cfg.Set("db.port", "80")
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "path[db.port] expect integer, got string")
+	ast.Nil(cfg.Set("db.port", 8080))
+	ast.EqualValues(8080, cfg.Int("db.port"))
+
+	// missing node
+	err = SchemaValidator(schema, "cache")(map[string]interface{}{"db": map[string]interface{}{}}, nil)
+	ast.Equal([]*SchemaError{{KeyPath: "cache", Message: "required"}}, SchemaErrors(err))
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	selectorDefaultKey = "_default"
+	selectorWhenKey    = "_when"
+	selectorValueKey   = "value"
+	selectorSuffixSep  = "@"
+)
+
+var (
+	_attrsMu  sync.RWMutex
+	_attrs    = defaultInstanceAttributes()
+	_attrsGen uint64
+)
+
+func defaultInstanceAttributes() map[string]string {
+	attrs := make(map[string]string)
+	if hostname, err := os.Hostname(); err == nil {
+		attrs["hostname"] = hostname
+	}
+
+	return attrs
+}
+
+// SetInstanceAttributes 设置实例属性（如env、region、cluster），用于解析异步配置中的条件值
+// 属性与已有属性合并，值为空字符串时删除该属性。默认包含hostname
+//
+// 设置后，已添加的异步配置Layer会立即重新加载并按新的属性解析
+//
+// 条件值支持两种写法：
+//
+//	// 条件节点：依次匹配_when中的条件（除value外的所有字段），都不匹配时使用_default，没有_default时删除该节点
+//	"timeout": {"_default": 100, "_when": [{"env": "prod", "region": "eu", "value": 300}]}
+//
+//	// 后缀写法：条件匹配时覆盖同名节点，多个匹配时条件最多的生效，不匹配的节点被删除
+//	"timeout": 100,
+//	"timeout@env=prod,region=eu": 300
+//
+// 条件值可以是多个候选值，如 {"env": ["prod", "staging"]} 或 timeout@env=prod|staging
+//
+// 注意：使用了条件值的异步配置不支持Set（返回ErrComposedConfig）
+func SetInstanceAttributes(attrs map[string]string) {
+	_attrsMu.Lock()
+	newAttrs := make(map[string]string, len(_attrs)+len(attrs))
+	for k, v := range _attrs {
+		newAttrs[k] = v
+	}
+	for k, v := range attrs {
+		if v == "" {
+			delete(newAttrs, k)
+		} else {
+			newAttrs[k] = v
+		}
+	}
+	_attrs = newAttrs
+	atomic.AddUint64(&_attrsGen, 1)
+	_attrsMu.Unlock()
+
+	_cfg.layers.Range(func(_, layer interface{}) bool {
+		if c, ok := layer.(*AsyncConfig); ok {
+			c.Configer.(*asyncConfig).refresh()
+		}
+		return true
+	})
+}
+
+// InstanceAttributes 返回当前的实例属性
+func InstanceAttributes() map[string]string {
+	_attrsMu.RLock()
+	defer _attrsMu.RUnlock()
+
+	attrs := make(map[string]string, len(_attrs))
+	for k, v := range _attrs {
+		attrs[k] = v
+	}
+
+	return attrs
+}
+
+func instanceAttributes() (map[string]string, uint64) {
+	_attrsMu.RLock()
+	defer _attrsMu.RUnlock()
+
+	return _attrs, atomic.LoadUint64(&_attrsGen)
+}
+
+// parseAttributes 解析 "env=prod,region=eu" 格式的属性
+func parseAttributes(s string) (map[string]string, bool) {
+	attrs := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, false
+		}
+		attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return attrs, true
+}
+
+// resolveSelectors 按实例属性解析配置树中的条件值，异步配置加载时调用
+func resolveSelectors(tree interface{}, attrs map[string]string) interface{} {
+	switch v := tree.(type) {
+	case map[string]interface{}:
+		if isSelectorNode(v) {
+			return resolveSelectorNode(v, attrs)
+		}
+		return resolveSelectorMap(v, attrs)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = resolveSelectors(item, attrs)
+		}
+		return items
+	}
+
+	return tree
+}
+
+// hasSelectors 返回配置树中是否有条件值
+func hasSelectors(tree interface{}) bool {
+	switch v := tree.(type) {
+	case map[string]interface{}:
+		if isSelectorNode(v) {
+			return true
+		}
+		for k, item := range v {
+			if _, _, ok := parseSelectorKey(k); ok || hasSelectors(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasSelectors(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isSelectorNode(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if k != selectorDefaultKey && k != selectorWhenKey {
+			return false
+		}
+	}
+
+	return true
+}
+
+func resolveSelectorNode(m map[string]interface{}, attrs map[string]string) interface{} {
+	whens, _ := m[selectorWhenKey].([]interface{})
+	for _, item := range whens {
+		when, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		matched := true
+		for name, cond := range when {
+			if name != selectorValueKey && !matchAttribute(attrs, name, cond) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return resolveSelectors(when[selectorValueKey], attrs)
+		}
+	}
+
+	return resolveSelectors(m[selectorDefaultKey], attrs)
+}
+
+type selectorOverride struct {
+	key   string
+	conds int
+}
+
+func resolveSelectorMap(m map[string]interface{}, attrs map[string]string) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	overrides := make(map[string]selectorOverride)
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		base, conds, ok := parseSelectorKey(k)
+		if !ok {
+			// 未匹配的条件节点被删除
+			if val := resolveSelectors(m[k], attrs); val != nil || m[k] == nil {
+				ret[k] = val
+			}
+			continue
+		}
+
+		matched := true
+		for name, cond := range conds {
+			if !matchAttribute(attrs, name, cond) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			if o, exists := overrides[base]; !exists || len(conds) >= o.conds {
+				overrides[base] = selectorOverride{key: k, conds: len(conds)}
+			}
+		}
+	}
+
+	for base, o := range overrides {
+		ret[base] = resolveSelectors(m[o.key], attrs)
+	}
+
+	return ret
+}
+
+// parseSelectorKey 解析 key@env=prod,region=eu 格式的节点名，多个候选值以|分隔
+func parseSelectorKey(key string) (base string, conds map[string]interface{}, ok bool) {
+	idx := strings.Index(key, selectorSuffixSep)
+	if idx <= 0 {
+		return key, nil, false
+	}
+
+	attrs, ok := parseAttributes(key[idx+1:])
+	if !ok {
+		return key, nil, false
+	}
+
+	conds = make(map[string]interface{}, len(attrs))
+	for name, value := range attrs {
+		options := strings.Split(value, "|")
+		candidates := make([]interface{}, len(options))
+		for i, option := range options {
+			candidates[i] = option
+		}
+		conds[name] = candidates
+	}
+
+	return key[:idx], conds, true
+}
+
+func matchAttribute(attrs map[string]string, name string, cond interface{}) bool {
+	attr, ok := attrs[name]
+	if !ok {
+		return false
+	}
+
+	if candidates, ok := cond.([]interface{}); ok {
+		for _, c := range candidates {
+			if fmt.Sprint(c) == attr {
+				return true
+			}
+		}
+		return false
+	}
+
+	return fmt.Sprint(cond) == attr
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSelectors(t *testing.T) {
+	ast := assert.New(t)
+
+	tree, err := ParseContent([]byte(`
+	{
+		"timeout": {"_default": 100, "_when": [
+			{"env": "prod", "region": "eu", "value": 300},
+			{"env": ["prod", "staging"], "value": {"_default": 200}}
+		]},
+		"debug": true,
+		"debug@env=prod": false,
+		"pool": 10,
+		"pool@env=prod": 20,
+		"pool@env=prod,region=eu": 30,
+		"canary": {"_when": [{"cluster": "c1", "value": true}]},
+		"servers": [{"host": {"_default": "a", "_when": [{"region": "eu", "value": "b"}]}}],
+		"empty": null
+	}
+	`), T_JSON)
+	ast.Nil(err)
+
+	tests := []struct {
+		attrs  map[string]string
+		expect string
+	}{
+		{
+			map[string]string{},
+			`{"debug":true,"empty":null,"pool":10,"servers":[{"host":"a"}],"timeout":100}`,
+		},
+		{
+			map[string]string{"env": "prod", "region": "eu", "cluster": "c1"},
+			`{"canary":true,"debug":false,"empty":null,"pool":30,"servers":[{"host":"b"}],"timeout":300}`,
+		},
+		{
+			map[string]string{"env": "staging", "region": "eu"},
+			`{"debug":true,"empty":null,"pool":10,"servers":[{"host":"b"}],"timeout":200}`,
+		},
+		{
+			map[string]string{"env": "prod", "region": "us"},
+			`{"debug":false,"empty":null,"pool":20,"servers":[{"host":"a"}],"timeout":200}`,
+		},
+	}
+
+	for _, test := range tests {
+		data, err := JSONMarshaler{}.Marshal(resolveSelectors(tree, test.attrs))
+		ast.Nil(err)
+		ast.JSONEq(test.expect, string(data), "%v", test.attrs)
+	}
+}
+
+func TestInstanceAttributes(t *testing.T) {
+	ast := assert.New(t)
+
+	key := "selector_key"
+	layerName := "selector_layer"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"timeout": 100, "timeout@env=prod": 300}`),
+	}}
+	AddLayer(layerName, NewAsyncConfig(remote, key, 0, false))
+	defer RemoveLayer(layerName)
+
+	ast.EqualValues(100, Int("timeout", layerName))
+	ast.NotEmpty(InstanceAttributes()["hostname"])
+
+	SetInstanceAttributes(map[string]string{"env": "prod"})
+	ast.Equal("prod", InstanceAttributes()["env"])
+	ast.EqualValues(300, Int("timeout", layerName))
+
+	SetInstanceAttributes(map[string]string{"env": ""})
+	_, ok := InstanceAttributes()["env"]
+	ast.False(ok)
+	ast.EqualValues(100, Int("timeout", layerName))
+}
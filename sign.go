@@ -0,0 +1,304 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureSuffix 分离签名所在的Key的后缀，如app_config的签名在app_config.sig中
+	SignatureSuffix = ".sig"
+
+	signatureAlg    = "ed25519"
+	signatureHeader = "signature: "
+
+	// signaturePayloadPrefix 签名内容的前缀，签名覆盖 前缀+Key+序号+内容
+	signaturePayloadPrefix = "techxmind-config-signature-v1\n"
+)
+
+var (
+	// ErrUnsigned 配置内容没有签名
+	ErrUnsigned = errors.New("content not signed")
+
+	// ErrBadSignature 签名无效或签名的密钥不受信任
+	ErrBadSignature = errors.New("bad signature")
+
+	// ErrSignedConfig 需校验签名的配置不支持Set（写回的内容没有签名）
+	ErrSignedConfig = errors.New("cannot set signed config")
+
+	// ErrSignatureRollback 签名的序号小于已接受的序号（旧版本的内容被重新写入）
+	ErrSignatureRollback = errors.New("signature rolled back")
+)
+
+var (
+	// 各Key已校验通过的最大签名序号，防止回滚至旧的签名内容
+	_signatureSeqMu sync.Mutex
+	_signatureSeqs  = make(map[string]uint64)
+)
+
+// TrustedKeys 受信任的ed25519公钥，key为密钥ID
+//
+// 设置后（见WithTrustedKeys），配置内容必须带有其中某个密钥的签名，签名有两种形式：
+//
+//	# signature: ed25519 <keyID> <seq> <base64>    内容第一行（JSON中为 // signature: ...），签名不含该行
+//	ed25519 <keyID> <seq> <base64>                 分离签名，位于Key+SignatureSuffix中
+//
+// 签名覆盖配置的Key、序号seq及内容：为其它Key签名的内容不能用于该Key；
+// seq为递增的序号（configctl sign默认使用当前时间戳），小于进程内已接受的序号的内容被拒绝（ErrSignatureRollback），防止回滚至旧版本。
+// 首行签名优先；没有签名或签名无效的内容被拒绝，继续使用之前的内容（见RejectEvent）。
+// 被引用的配置（见IncludeKey）同样需要签名。这类配置的Set返回ErrSignedConfig，需签名后直接写入Asyncer
+type TrustedKeys map[string]ed25519.PublicKey
+
+// ParseTrustedKeys 解析 id:base64key 格式的公钥列表，以逗号或换行分隔，#开头的行为注释
+func ParseTrustedKeys(s string) (TrustedKeys, error) {
+	keys := make(TrustedKeys)
+	err := parseKeyList(s, func(id string, key []byte) error {
+		if len(key) != ed25519.PublicKeySize {
+			return errors.Errorf("public key[%s] must be %d bytes, got %d", id, ed25519.PublicKeySize, len(key))
+		}
+		keys[id] = ed25519.PublicKey(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("empty trusted keys")
+	}
+
+	return keys, nil
+}
+
+// LoadTrustedKeys 按描述读取受信任的公钥：env:NAME 或 file:PATH，格式见ParseTrustedKeys
+func LoadTrustedKeys(spec string) (TrustedKeys, error) {
+	s, err := readKeySpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTrustedKeys(s)
+}
+
+// ParseSigningKey 解析 id:base64key 格式的签名私钥，key为32字节的种子或64字节的私钥
+func ParseSigningKey(s string) (string, ed25519.PrivateKey, error) {
+	var (
+		kid string
+		key ed25519.PrivateKey
+	)
+	err := parseKeyList(s, func(id string, b []byte) error {
+		if kid != "" {
+			return errors.New("more than one signing key")
+		}
+		if strings.ContainsAny(id, " \t") {
+			return errors.Errorf("invalid key id[%s]", id)
+		}
+		switch len(b) {
+		case ed25519.SeedSize:
+			key = ed25519.NewKeyFromSeed(b)
+		case ed25519.PrivateKeySize:
+			key = ed25519.PrivateKey(b)
+		default:
+			return errors.Errorf("signing key[%s] must be %d or %d bytes, got %d", id, ed25519.SeedSize, ed25519.PrivateKeySize, len(b))
+		}
+		kid = id
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if kid == "" {
+		return "", nil, errors.New("empty signing key")
+	}
+
+	return kid, key, nil
+}
+
+// LoadSigningKey 按描述读取签名私钥：env:NAME 或 file:PATH，格式见ParseSigningKey
+func LoadSigningKey(spec string) (string, ed25519.PrivateKey, error) {
+	s, err := readKeySpec(spec)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return ParseSigningKey(s)
+}
+
+// DetachedSignature 返回配置asyncKey的内容content的分离签名，用于写入asyncKey+SignatureSuffix，seq为递增的序号
+func DetachedSignature(key ed25519.PrivateKey, kid string, asyncKey string, seq uint64, content []byte) []byte {
+	sig := ed25519.Sign(key, signaturePayload(asyncKey, seq, content))
+
+	return []byte(signatureAlg + " " + kid + " " + strconv.FormatUint(seq, 10) + " " + base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// SignContent 返回在第一行加上签名后的配置asyncKey的内容，已有的首行签名会被替换，seq为递增的序号
+func SignContent(key ed25519.PrivateKey, kid string, asyncKey string, seq uint64, content []byte, contentType ContentType) []byte {
+	if _, body, ok := splitSignatureHeader(content); ok {
+		content = body
+	}
+
+	prefix := "# "
+	if contentType == T_JSON {
+		prefix = "// "
+	}
+	header := DetachedSignature(key, kid, asyncKey, seq, content)
+
+	return append([]byte(prefix+signatureHeader+string(header)), content...)
+}
+
+// signaturePayload 返回签名的内容，包含配置的Key及序号
+func signaturePayload(asyncKey string, seq uint64, content []byte) []byte {
+	payload := make([]byte, 0, len(signaturePayloadPrefix)+len(asyncKey)+len(content)+22)
+	payload = append(payload, signaturePayloadPrefix...)
+	payload = append(payload, asyncKey...)
+	payload = append(payload, '\n')
+	payload = strconv.AppendUint(payload, seq, 10)
+	payload = append(payload, '\n')
+
+	return append(payload, content...)
+}
+
+// verify 校验配置asyncKey的签名行（alg keyID seq base64），返回签名的序号
+func (keys TrustedKeys) verify(asyncKey string, content []byte, signature string) (uint64, error) {
+	fields := strings.Fields(signature)
+	if len(fields) != 4 || fields[0] != signatureAlg {
+		return 0, errors.Wrapf(ErrBadSignature, "invalid signature[%s]", signature)
+	}
+	key, ok := keys[fields[1]]
+	if !ok {
+		return 0, errors.Wrapf(ErrBadSignature, "untrusted key[%s]", fields[1])
+	}
+	seq, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrBadSignature, "invalid seq[%s]", fields[2])
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil || !ed25519.Verify(key, signaturePayload(asyncKey, seq, content), sig) {
+		return 0, errors.Wrapf(ErrBadSignature, "key[%s]", fields[1])
+	}
+
+	return seq, nil
+}
+
+// checkSignatureSeq 记录asyncKey已校验通过的序号，小于已记录的序号时返回ErrSignatureRollback
+func checkSignatureSeq(asyncKey string, seq uint64) error {
+	_signatureSeqMu.Lock()
+	defer _signatureSeqMu.Unlock()
+
+	if last := _signatureSeqs[asyncKey]; seq < last {
+		return errors.Wrapf(ErrSignatureRollback, "seq %d < %d", seq, last)
+	}
+	_signatureSeqs[asyncKey] = seq
+
+	return nil
+}
+
+// verifyContent 校验key的内容的签名及序号，返回去掉首行签名后的内容及分离签名的版本（首行签名时为空）
+func verifyContent(ctx context.Context, asyncer AsyncerV2, key string, content []byte, keys TrustedKeys) ([]byte, Version, error) {
+	var (
+		signature  string
+		sigVersion Version
+	)
+	if header, body, ok := splitSignatureHeader(content); ok {
+		signature, content = header, body
+	} else {
+		detached, version, err := asyncer.Get(ctx, key+SignatureSuffix)
+		if err == ErrEmptyContent {
+			return nil, "", errors.Wrapf(ErrUnsigned, "verify config[%s]", key)
+		}
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "get signature of config[%s]", key)
+		}
+		signature, sigVersion = string(detached), version
+	}
+
+	seq, err := keys.verify(key, content, signature)
+	if err == nil {
+		err = checkSignatureSeq(key, seq)
+	}
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "verify config[%s]", key)
+	}
+
+	return content, sigVersion, nil
+}
+
+// splitSignatureHeader 拆分首行签名（# signature: ... 或 // signature: ...）及签名的内容
+func splitSignatureHeader(content []byte) (string, []byte, bool) {
+	idx := bytes.IndexByte(content, '\n')
+	if idx < 0 {
+		return "", nil, false
+	}
+
+	line := strings.TrimRight(string(content[:idx]), "\r")
+	for _, prefix := range []string{"#", "//"} {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		line = strings.TrimSpace(line[len(prefix):])
+		if strings.HasPrefix(line, signatureHeader) {
+			return line[len(signatureHeader):], content[idx+1:], true
+		}
+	}
+
+	return "", nil, false
+}
+
+// parseKeyList 解析 id:base64key 格式的密钥列表，以逗号或换行分隔，#开头的行为注释
+func parseKeyList(s string, fn func(id string, key []byte) error) error {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, item := range strings.Split(line, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			idx := strings.Index(item, ":")
+			if idx <= 0 {
+				return errors.Errorf("invalid key[%s], want id:base64key", item)
+			}
+			id := item[:idx]
+			key, err := base64.StdEncoding.DecodeString(item[idx+1:])
+			if err != nil {
+				return errors.Wrapf(err, "decode key[%s]", id)
+			}
+			if err := fn(id, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readKeySpec 读取 env:NAME 或 file:PATH 的内容
+func readKeySpec(spec string) (string, error) {
+	switch {
+	case strings.HasPrefix(spec, "env:"):
+		name := spec[len("env:"):]
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("env[%s] not set", name)
+		}
+		return s, nil
+	case strings.HasPrefix(spec, "file:"):
+		content, err := ioutil.ReadFile(spec[len("file:"):])
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+
+	return "", errors.Errorf("invalid key spec[%s], want env:NAME or file:PATH", spec)
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSigningKeys(t *testing.T) {
+	ast := assert.New(t)
+
+	seed := bytes.Repeat([]byte{3}, ed25519.SeedSize)
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	enc := base64.StdEncoding
+
+	kid, priv, err := ParseSigningKey("k1:" + enc.EncodeToString(seed))
+	ast.Nil(err)
+	ast.Equal("k1", kid)
+	ast.Equal(pub, priv.Public())
+
+	_, _, err = ParseSigningKey("k1:" + enc.EncodeToString(seed) + ",k2:" + enc.EncodeToString(seed))
+	ast.Error(err)
+	_, _, err = ParseSigningKey("k1:" + enc.EncodeToString(pub[:16]))
+	ast.Error(err)
+
+	keys, err := ParseTrustedKeys("# ops\nk1:" + enc.EncodeToString(pub) + "\n")
+	ast.Nil(err)
+	ast.Equal(TrustedKeys{"k1": pub}, keys)
+	_, err = ParseTrustedKeys("# empty")
+	ast.Error(err)
+	_, err = ParseTrustedKeys("k1:" + enc.EncodeToString(seed[:8]))
+	ast.Error(err)
+}
+
+func TestSignContent(t *testing.T) {
+	ast := assert.New(t)
+	resetSignatureSeqs()
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{4}, ed25519.SeedSize))
+	keys := TrustedKeys{"k1": priv.Public().(ed25519.PublicKey)}
+
+	content := []byte(`{"a": 1}`)
+	signed := SignContent(priv, "k1", "sign_content", 2, content, T_JSON)
+	ast.Contains(string(signed), "// signature: ed25519 k1 2 ")
+	// re-signing replaces the header
+	ast.Equal(signed, SignContent(priv, "k1", "sign_content", 2, signed, T_JSON))
+
+	// readers without trusted keys see a comment
+	tree, err := ParseContent(processRawMessage(signed, T_JSON), T_JSON)
+	ast.Nil(err)
+	ast.Equal(map[string]interface{}{"a": int64(1)}, tree)
+	tree, err = ParseContent(SignContent(priv, "k1", "sign_content", 2, []byte("a: 1\n"), T_YAML), T_YAML)
+	ast.Nil(err)
+	ast.Equal(map[string]interface{}{"a": 1}, tree)
+
+	ctx := context.Background()
+	asyncer := AdaptAsyncer(&slowAsyncer{data: map[string][]byte{}})
+	body, _, err := verifyContent(ctx, asyncer, "sign_content", signed, keys)
+	ast.Nil(err)
+	ast.Equal(content, body)
+
+	tampered := bytes.Replace(signed, []byte(`"a": 1`), []byte(`"a": 2`), 1)
+	_, _, err = verifyContent(ctx, asyncer, "sign_content", tampered, keys)
+	ast.True(errors.Is(err, ErrBadSignature))
+
+	_, _, err = verifyContent(ctx, asyncer, "sign_content", signed, TrustedKeys{"k2": keys["k1"]})
+	ast.True(errors.Is(err, ErrBadSignature))
+
+	_, _, err = verifyContent(ctx, asyncer, "sign_content", content, keys)
+	ast.True(errors.Is(err, ErrUnsigned))
+
+	// content signed for another key is not valid for this key
+	_, _, err = verifyContent(ctx, asyncer, "sign_content_prod", signed, keys)
+	ast.True(errors.Is(err, ErrBadSignature))
+
+	// the same key can not be rolled back to an older signature
+	_, _, err = verifyContent(ctx, asyncer, "sign_content", SignContent(priv, "k1", "sign_content", 1, content, T_JSON), keys)
+	ast.True(errors.Is(err, ErrSignatureRollback))
+	_, _, err = verifyContent(ctx, asyncer, "sign_content", SignContent(priv, "k1", "sign_content", 3, content, T_JSON), keys)
+	ast.Nil(err)
+}
+
+func TestVerifyAsyncConfig(t *testing.T) {
+	ast := assert.New(t)
+	resetSignatureSeqs()
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{5}, ed25519.SeedSize))
+	keys := TrustedKeys{"k1": priv.Public().(ed25519.PublicKey)}
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{6}, ed25519.SeedSize))
+
+	key := "sign_key"
+	content := []byte(`{"$include": "sign_common", "a": 1}`)
+	common := []byte(`{"b": 1}`)
+	remote := &slowAsyncer{data: map[string][]byte{
+		key:                             SignContent(priv, "k1", key, 1, content, T_JSON),
+		"sign_common":                   common,
+		"sign_common" + SignatureSuffix: DetachedSignature(priv, "k1", "sign_common", 1, common),
+	}}
+
+	cfg := NewAsyncConfig(remote, key, time.Millisecond, false, WithTrustedKeys(keys))
+	defer cfg.Close()
+	ast.Equal(int64(1), cfg.Get("a"))
+	ast.Equal(int64(1), cfg.Get("b"))
+
+	// unsigned content is rejected, previous value kept
+	remote.Set(key, []byte(`{"a": 2}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(1), cfg.Get("a"))
+	ast.True(errors.Is(cfg.Rejected().Err, ErrUnsigned))
+
+	// signed with an untrusted key
+	remote.Set(key, SignContent(other, "k1", key, 2, []byte(`{"a": 3}`), T_JSON))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(1), cfg.Get("a"))
+	ast.True(errors.Is(cfg.Rejected().Err, ErrBadSignature))
+
+	// detached signature written after the content
+	remote.Set(key, []byte(`{"a": 4}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(1), cfg.Get("a"))
+	remote.Set(key+SignatureSuffix, DetachedSignature(priv, "k1", key, 3, []byte(`{"a": 4}`)))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(4), cfg.Get("a"))
+
+	// a signature of another key is replayed
+	remote.Set(key, SignContent(priv, "k1", "sign_common", 4, []byte(`{"a": 5}`), T_JSON))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(4), cfg.Get("a"))
+	ast.True(errors.Is(cfg.Rejected().Err, ErrBadSignature))
+
+	// an older signed version is pushed again
+	remote.Set(key, SignContent(priv, "k1", key, 1, content, T_JSON))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(4), cfg.Get("a"))
+	ast.True(errors.Is(cfg.Rejected().Err, ErrSignatureRollback))
+
+	// tampered included config
+	remote.Set(key, SignContent(priv, "k1", key, 4, content, T_JSON))
+	remote.Set("sign_common", []byte(`{"b": 2}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(4), cfg.Get("a"))
+	ast.Nil(cfg.Get("b"))
+
+	// Set would write unsigned content
+	ast.Equal(ErrSignedConfig, cfg.Set("a", 5))
+	ast.Equal(int64(4), cfg.Get("a"))
+}
+
+// fixedVersionAsyncer 内容变化时版本不变（如未更新版本号的数据库配置）
+type fixedVersionAsyncer struct {
+	AsyncerV2
+}
+
+func (a fixedVersionAsyncer) Get(ctx context.Context, key string) ([]byte, Version, error) {
+	content, _, err := a.AsyncerV2.Get(ctx, key)
+	return content, "v1", err
+}
+
+func TestVerifyBeforeVersionCheck(t *testing.T) {
+	ast := assert.New(t)
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	keys := TrustedKeys{"k1": priv.Public().(ed25519.PublicKey)}
+
+	key := "sign_version_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: SignContent(priv, "k1", key, 1, []byte(`{"a": 1}`), T_JSON),
+	}}
+
+	cfg := NewAsyncConfigV2(fixedVersionAsyncer{AdaptAsyncer(remote)}, key, time.Millisecond, false, WithTrustedKeys(keys))
+	defer cfg.Close()
+	ast.Equal(int64(1), cfg.Get("a"))
+	ast.Nil(cfg.Rejected())
+
+	// tampered content keeping the version is still verified
+	remote.Set(key, []byte(`{"a": 2}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal(int64(1), cfg.Get("a"))
+	ast.True(errors.Is(cfg.Rejected().Err, ErrUnsigned))
+}
+
+// resetSignatureSeqs 清除已记录的签名序号，使测试可重复执行
+func resetSignatureSeqs() {
+	_signatureSeqMu.Lock()
+	defer _signatureSeqMu.Unlock()
+
+	_signatureSeqs = make(map[string]uint64)
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/techxmind/go-utils/object"
+)
+
+var (
+	// ErrReadOnly 配置只读，如SnapshotConfig
+	ErrReadOnly = errors.New("config is read-only")
+)
+
+// SnapshotConfig 配置在某一时刻的只读快照
+//
+// 快照仅保存各Layer当时的配置树，不复制配置内容，之后Layer的刷新或Set不会影响快照的查询结果，
+// 用于保证一次请求内读取到的配置一致
+//
+// 注意：非同步模式的MapConfig（NewMapConfig(m, false)）会直接修改原配置树，快照无法隔离其变更
+type SnapshotConfig struct {
+	ConfigHelper
+}
+
+type snapshotConfig struct {
+	layerNames []string
+	trees      []interface{}
+	locals     []bool // 各Layer是否为本地配置，见localLayer
+
+	// 合并视图模式下，首次查询map节点时合并各Layer的配置树
+	merged     bool
+	mergeOnce  sync.Once
+	mergedTree map[string]interface{}
+
+	// 引用在快照内解析
+	interpolation bool
+}
+
+// Snapshot 返回指定Layer当前配置的快照，未指定LayerNames，默认为DefaultLayerNames
+//
+//	s := cfg.Snapshot()
+//	host, port := s.String("db.host"), s.Int("db.port") // 同一版本的配置
+func (cfg *defaultConfig) Snapshot(layerNames ...string) *SnapshotConfig {
+	if len(layerNames) == 0 {
+		layerNames = cfg.defaultLayerNames.Load().([]string)
+	}
+
+	s := &snapshotConfig{
+		layerNames: make([]string, 0, len(layerNames)),
+		trees:      make([]interface{}, 0, len(layerNames)),
+		locals:     make([]bool, 0, len(layerNames)),
+		merged:     cfg.mergedViewEnabled(),
+
+		interpolation: cfg.interpolationEnabled(),
+	}
+
+	for _, name := range layerNames {
+		if layer, ok := cfg.layers.Load(name); ok {
+			s.layerNames = append(s.layerNames, name)
+			s.trees = append(s.trees, layer.(Configer).Get(RootKey))
+			s.locals = append(s.locals, cfg.isLocalLayer(name))
+		}
+	}
+
+	return &SnapshotConfig{
+		ConfigHelper: ConfigHelper{
+			Configer: s,
+		},
+	}
+}
+
+func Snapshot(layerNames ...string) *SnapshotConfig {
+	return _cfg.Snapshot(layerNames...)
+}
+
+func (s *snapshotConfig) Get(keyPath string) interface{} {
+	val, _ := s.lookup(keyPath)
+
+	return val
+}
+
+func (s *snapshotConfig) lookup(keyPath string) (interface{}, string) {
+	val, layerName, local := s.lookupRaw(keyPath)
+	if !s.interpolation || !hasInterpolation(val) {
+		return val, layerName
+	}
+
+	val, _ = interpolate(keyPath, val, local, func(keyPath string) (interface{}, bool) {
+		val, _, local := s.lookupRaw(keyPath)
+		return val, local
+	})
+
+	return val, layerName
+}
+
+// lookupRaw 返回解析引用前的值、所在的Layer及是否来自本地配置
+func (s *snapshotConfig) lookupRaw(keyPath string) (interface{}, string, bool) {
+	for i, tree := range s.trees {
+		val := tree
+		if keyPath != RootKey {
+			val, _ = object.GetValue(tree, keyPath)
+		}
+		if val == nil {
+			continue
+		}
+
+		if _, isMap := val.(map[string]interface{}); isMap && s.merged {
+			s.mergeOnce.Do(func() {
+				s.mergedTree = mergeTrees(s.trees)
+			})
+			if keyPath == RootKey {
+				val = s.mergedTree
+			} else {
+				val, _ = object.GetValue(s.mergedTree, keyPath)
+			}
+			// 合并的值可能来自任一Layer
+			return val, s.layerNames[i], s.allLocal()
+		}
+
+		return val, s.layerNames[i], s.locals[i]
+	}
+
+	return nil, "", false
+}
+
+func (s *snapshotConfig) allLocal() bool {
+	for _, local := range s.locals {
+		if !local {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *snapshotConfig) Set(keyPath string, value interface{}) error {
+	return ErrReadOnly
+}
+
+// Watch 快照不会变化，返回的订阅不会收到通知
+func (s *snapshotConfig) Watch(notifier chan struct{}) Subscription {
+	return nopSubscription{}
+}
+
+func (s *snapshotConfig) WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	return nopSubscription{}
+}
+
+type snapshotContextKey struct{}
+
+// WithSnapshot 返回保存了配置快照的Context，ctx中已有快照时直接返回ctx
+// 快照包含WithLayers附加的Layer及默认Layer
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		ctx := config.WithSnapshot(r.Context())
+//		cfg := config.FromContext(ctx)
+//		...
+//	}
+func WithSnapshot(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(snapshotContextKey{}).(*SnapshotConfig); ok {
+		return ctx
+	}
+
+	return ContextWithSnapshot(ctx, Snapshot(_cfg.searchLayerNames(ctx)...))
+}
+
+// ContextWithSnapshot 返回保存了快照s的Context
+func ContextWithSnapshot(ctx context.Context, s *SnapshotConfig) context.Context {
+	return context.WithValue(ctx, snapshotContextKey{}, s)
+}
+
+// FromContext 返回ctx中保存的配置快照，ctx中没有快照时返回当前配置的快照（含WithLayers附加的Layer）
+func FromContext(ctx context.Context) *SnapshotConfig {
+	if s, ok := ctx.Value(snapshotContextKey{}).(*SnapshotConfig); ok {
+		return s
+	}
+
+	return Snapshot(_cfg.searchLayerNames(ctx)...)
+}
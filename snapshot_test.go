@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	base := NewMapConfig(map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost", "port": 3306},
+	})
+	cfg.AddLayer(DefaultLayerName, base)
+
+	key := "snapshot_key"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"db":{"host":"a.example.com"},"version":1}`),
+	}}
+	cfg.AddLayer("remote", NewAsyncConfig(remote, key, time.Millisecond, false))
+	cfg.AddDefaultLayerName("remote")
+
+	s := cfg.Snapshot()
+	ast.Equal("a.example.com", s.String("db.host"))
+	ast.EqualValues(3306, s.Int("db.port"))
+
+	// later changes are not visible in the snapshot
+	remote.Set(key, []byte(`{"db":{"host":"b.example.com"},"version":2}`))
+	ast.Nil(base.Set("db.port", 3307))
+	time.Sleep(2 * time.Millisecond)
+	ast.Equal("b.example.com", cfg.String("db.host"))
+	ast.EqualValues(2, cfg.Int("version"))
+	ast.Equal("a.example.com", s.String("db.host"))
+	ast.EqualValues(1, s.Int("version"))
+	ast.EqualValues(3306, s.Int("db.port"))
+
+	ast.Equal(ErrReadOnly, s.Set("version", 3))
+	_, err := s.StringE("version")
+	ast.Nil(err)
+	_, err = s.IntE("db.host")
+	ast.Equal("remote", err.(*TypeError).Layer)
+
+	// explicit layers
+	ast.EqualValues(3307, cfg.Snapshot(DefaultLayerName).Int("db.port"))
+
+	// merged view
+	cfg.EnableMergedView(true)
+	s = cfg.Snapshot()
+	ast.EqualValues(3307, s.Map("db").Int("port"))
+	ast.Equal("b.example.com", s.Map("db").String("host"))
+}
+
+func TestSnapshotContext(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Nil(Set("snapshot_ctx", 1))
+	ctx := WithSnapshot(context.Background())
+	ast.Equal(ctx, WithSnapshot(ctx), "keep existing snapshot")
+	ast.Nil(Set("snapshot_ctx", 2))
+
+	ast.EqualValues(1, FromContext(ctx).Int("snapshot_ctx"))
+	ast.EqualValues(2, FromContext(context.Background()).Int("snapshot_ctx"))
+}
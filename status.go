@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// 首次加载失败后的重试间隔
+	_loadRetryInterval = time.Second
+)
+
+// AsyncOption 异步配置的可选项
+type AsyncOption func(*asyncConfig)
+
+// WithRequired 配置是否必须加载成功
+// WaitReady会等待所有Required的配置至少成功加载一次
+func WithRequired(required bool) AsyncOption {
+	return func(cfg *asyncConfig) {
+		cfg.required = required
+	}
+}
+
+// WithFetchTimeout 每次获取异步配置的超时时间，<= 0 不超时
+func WithFetchTimeout(timeout time.Duration) AsyncOption {
+	return func(cfg *asyncConfig) {
+		cfg.fetchTimeout = timeout
+	}
+}
+
+// WithValidator 添加配置校验，首次加载的内容同样需要通过校验
+func WithValidator(validators ...Validator) AsyncOption {
+	return func(cfg *asyncConfig) {
+		cfg.validators = append(cfg.validators, validators...)
+	}
+}
+
+// WithTrustedKeys 配置内容必须带有keys中某个密钥的签名（见TrustedKeys），keys为空时不校验
+func WithTrustedKeys(keys TrustedKeys) AsyncOption {
+	return func(cfg *asyncConfig) {
+		cfg.trustedKeys = keys
+	}
+}
+
+// WithLocalTags 是否解析YAML中读取本机环境变量、文件的!env、!file标签（见SetSecretResolver），
+// 开启后配置值中的引用同样可以读取环境变量（见EnableInterpolation）
+// 只应用于本地的配置，使用FileAsyncer（含被CachedAsyncer等包装的）的配置默认开启
+func WithLocalTags(enabled bool) AsyncOption {
+	return func(cfg *asyncConfig) {
+		cfg.localTags = enabled
+	}
+}
+
+// LayerStatus 配置层的加载状态，用于健康检查
+type LayerStatus struct {
+	Layer    string    `json:"layer"`
+	Source   string    `json:"source,omitempty"`
+	Required bool      `json:"required"`
+	Ready    bool      `json:"ready"`
+	Stale    bool      `json:"stale"`
+	Version  Version   `json:"version,omitempty"`
+	LoadTime time.Time `json:"load_time"`
+
+	// 当前远程内容未通过校验，仍在使用之前的内容，被拒绝的内容见AsyncConfig.Rejected
+	Rejected bool `json:"rejected"`
+
+	// 最近一次加载失败的错误及时间，加载成功后清空
+	// LastErrorMessage为错误信息（敏感值已掩码），用于JSON输出
+	LastError        error     `json:"-"`
+	LastErrorMessage string    `json:"last_error,omitempty"`
+	LastErrorTime    time.Time `json:"last_error_time"`
+}
+
+// statuser 由需要加载的配置实现
+type statuser interface {
+	Status() LayerStatus
+	WaitReady(ctx context.Context) error
+}
+
+func (cfg *asyncConfig) isReady() bool {
+	select {
+	case <-cfg.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cfg *asyncConfig) setLoadResult(err error) {
+	cfg.statusMu.Lock()
+	defer cfg.statusMu.Unlock()
+
+	if err != nil {
+		cfg.lastErr = err
+		cfg.errTime = _now()
+		return
+	}
+
+	cfg.lastErr = nil
+	cfg.loadTime = _now()
+	cfg.readyOnce.Do(func() {
+		close(cfg.ready)
+	})
+}
+
+// retryLoad 首次加载失败时定期重试，直到加载成功或配置关闭
+// 间隔由调用方传入，避免后台goroutine读取可变的全局变量
+func (cfg *asyncConfig) retryLoad(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cfg.refresh()
+			if cfg.isReady() {
+				return
+			}
+		case <-cfg.quit:
+			return
+		}
+	}
+}
+
+func (cfg *asyncConfig) Status() LayerStatus {
+	cfg.statusMu.RLock()
+	defer cfg.statusMu.RUnlock()
+
+	status := LayerStatus{
+		Source:        cfg.asyncKey,
+		Required:      cfg.required,
+		Ready:         cfg.isReady(),
+		Version:       cfg.version,
+		Rejected:      cfg.rejectedMd5 != "",
+		LoadTime:      cfg.loadTime,
+		LastError:     cfg.lastErr,
+		LastErrorTime: cfg.errTime,
+	}
+	if cfg.lastErr != nil {
+		status.LastErrorMessage = Redact(RootKey, cfg.lastErr.Error()).(string)
+	}
+	if s, ok := cfg.asyncer.(staler); ok {
+		status.Stale = s.Stale(cfg.asyncKey)
+	}
+
+	return status
+}
+
+// WaitReady 等待配置首次加载成功
+func (cfg *asyncConfig) WaitReady(ctx context.Context) error {
+	select {
+	case <-cfg.ready:
+		return nil
+	case <-cfg.quit:
+		return ErrClosed
+	case <-ctx.Done():
+		cfg.statusMu.RLock()
+		lastErr := cfg.lastErr
+		cfg.statusMu.RUnlock()
+		if lastErr != nil {
+			return errors.Wrapf(ctx.Err(), "config[%s] not ready, last error:%v", cfg.asyncKey, lastErr)
+		}
+		return errors.Wrapf(ctx.Err(), "config[%s] not ready", cfg.asyncKey)
+	}
+}
+
+// Status 返回配置的加载状态
+func (c *AsyncConfig) Status() LayerStatus {
+	return c.Configer.(*asyncConfig).Status()
+}
+
+// WaitReady 等待配置首次加载成功，不论配置是否Required
+func (c *AsyncConfig) WaitReady(ctx context.Context) error {
+	return c.Configer.(*asyncConfig).WaitReady(ctx)
+}
+
+// Status 返回所有Layer的加载状态，按Layer名称排序
+// 无需加载的Layer（如MapConfig）总是Ready
+func (cfg *defaultConfig) Status() []LayerStatus {
+	var statuses []LayerStatus
+
+	cfg.layers.Range(func(name, layer interface{}) bool {
+		status := LayerStatus{
+			Ready: true,
+		}
+		if s, ok := layer.(statuser); ok {
+			status = s.Status()
+		}
+		status.Layer = name.(string)
+		statuses = append(statuses, status)
+		return true
+	})
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Layer < statuses[j].Layer
+	})
+
+	return statuses
+}
+
+func Status() []LayerStatus {
+	return _cfg.Status()
+}
+
+// WaitReady 等待所有Required的Layer至少成功加载一次
+// ctx结束时返回的错误中包含未就绪的Layer
+func (cfg *defaultConfig) WaitReady(ctx context.Context) error {
+	var (
+		names   []string
+		waiters []statuser
+	)
+
+	cfg.layers.Range(func(name, layer interface{}) bool {
+		if s, ok := layer.(statuser); ok && s.Status().Required {
+			names = append(names, name.(string))
+			waiters = append(waiters, s)
+		}
+		return true
+	})
+
+	var notReady []string
+	var lastErr error
+	for i, s := range waiters {
+		if err := s.WaitReady(ctx); err != nil {
+			notReady = append(notReady, names[i])
+			lastErr = err
+		}
+	}
+
+	if len(notReady) > 0 {
+		sort.Strings(notReady)
+		return errors.Wrapf(lastErr, "layers[%s] not ready", strings.Join(notReady, ","))
+	}
+
+	return nil
+}
+
+func WaitReady(ctx context.Context) error {
+	return _cfg.WaitReady(ctx)
+}
@@ -12,7 +12,9 @@ import (
 func JSONToMap(rawMessage json.RawMessage) (map[string]interface{}, error) {
 	var data interface{}
 
-	json.Unmarshal(rawMessage, &data)
+	if err := unmarshalJSON(rawMessage, &data); err != nil {
+		return nil, err
+	}
 
 	if m, ok := data.(map[string]interface{}); ok {
 		return m, nil
@@ -21,6 +23,20 @@ func JSONToMap(rawMessage json.RawMessage) (map[string]interface{}, error) {
 	return nil, fmt.Errorf("json data is not map[string]interface{} struct")
 }
 
+// ParseContent 按配置内容类型解析原始内容，与异步配置加载时的处理一致（如去除JSON注释）
+func ParseContent(content []byte, contentType ContentType) (interface{}, error) {
+	return parseContent(content, contentType, &yamlTagOptions{local: true})
+}
+
+func parseContent(content []byte, contentType ContentType, opts *yamlTagOptions) (interface{}, error) {
+	content = processRawMessage(content, contentType)
+	if len(content) == 0 {
+		return nil, ErrEmptyContent
+	}
+
+	return unmarshalContent(content, contentType, opts)
+}
+
 func PrintJSON(v interface{}) {
 	json, _ := json.MarshalIndent(v, "", "  ")
 	fmt.Println(string(json))
@@ -120,3 +120,32 @@ func TestMergeMap(t *testing.T) {
 	mergeMap(m1, m2)
 	ast.Equal(expectMap, m1)
 }
+
+func TestJSONToMapPreserveNumber(t *testing.T) {
+	ast := assert.New(t)
+	m, err := JSONToMap([]byte(`{"id": 1234567890123456789, "big": 18446744073709551615, "f": 0.5, "l": [1, 2]}`))
+
+	ast.Nil(err)
+	ast.Equal(int64(1234567890123456789), m["id"])
+	ast.Equal(uint64(18446744073709551615), m["big"])
+	ast.Equal(0.5, m["f"])
+	ast.Equal([]interface{}{int64(1), int64(2)}, m["l"])
+
+	cfg := NewMapConfig(m)
+	ast.Equal(int64(1234567890123456789), cfg.Int("id"))
+	ast.Equal(uint64(18446744073709551615), cfg.Uint("big"))
+	ast.Equal("1234567890123456789", cfg.String("id"))
+
+	bs, err := cfg.JSON("id")
+	ast.Nil(err)
+	ast.Equal("1234567890123456789", string(bs))
+
+	s := new(struct {
+		ID int64 `json:"id"`
+	})
+	ast.Nil(cfg.Remarshal(RootKey, s))
+	ast.Equal(int64(1234567890123456789), s.ID)
+
+	_, err = JSONToMap([]byte(`{"a": 1} x`))
+	ast.NotNil(err)
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Validator 校验新的配置内容，返回错误时拒绝新内容，继续使用旧内容
+// newTree/oldTree 为整个配置对象的值，首次加载时oldTree为nil
+type Validator func(newTree, oldTree interface{}) error
+
+// RejectEvent 配置内容校验失败被拒绝的事件
+type RejectEvent struct {
+	// 配置的来源，同LayerStatus.Source
+	Source string
+
+	// 被拒绝的内容，用于排查问题，敏感值已掩码（见redactContent）
+	Content []byte
+
+	Err  error
+	Time time.Time
+}
+
+// validatorAdder 由支持校验的配置实现
+type validatorAdder interface {
+	AddValidator(v Validator)
+	Rejected() *RejectEvent
+}
+
+var (
+	_rejectMu       sync.RWMutex
+	_rejectHandlers []*rejectHandler
+)
+
+type rejectHandler struct {
+	fn func(ev RejectEvent)
+}
+
+// OnReject 注册配置内容被拒绝时的回调
+// 回调在刷新配置的goroutine中同步执行，不应阻塞
+func OnReject(fn func(ev RejectEvent)) Subscription {
+	_rejectMu.Lock()
+	defer _rejectMu.Unlock()
+
+	h := &rejectHandler{fn: fn}
+	_rejectHandlers = append(_rejectHandlers[:len(_rejectHandlers):len(_rejectHandlers)], h)
+
+	return newSubscription(func() {
+		_rejectMu.Lock()
+		defer _rejectMu.Unlock()
+
+		handlers := make([]*rejectHandler, 0, len(_rejectHandlers))
+		for _, item := range _rejectHandlers {
+			if item != h {
+				handlers = append(handlers, item)
+			}
+		}
+		_rejectHandlers = handlers
+	})
+}
+
+func emitReject(ev RejectEvent) {
+	_rejectMu.RLock()
+	handlers := _rejectHandlers
+	_rejectMu.RUnlock()
+
+	for _, h := range handlers {
+		h.fn(ev)
+	}
+}
+
+func (cfg *asyncConfig) addValidator(v Validator) {
+	cfg.statusMu.Lock()
+	defer cfg.statusMu.Unlock()
+
+	cfg.validators = append(cfg.validators[:len(cfg.validators):len(cfg.validators)], v)
+}
+
+func (cfg *asyncConfig) validate(newTree, oldTree interface{}) error {
+	cfg.statusMu.RLock()
+	validators := cfg.validators
+	cfg.statusMu.RUnlock()
+
+	for _, v := range validators {
+		if err := v(newTree, oldTree); err != nil {
+			return errors.Wrapf(err, "validate config[%s]", cfg.asyncKey)
+		}
+	}
+
+	return nil
+}
+
+// reject 记录被拒绝的内容并发出事件，同一内容只记录一次
+func (cfg *asyncConfig) reject(content []byte, contentMd5 string, err error) error {
+	cfg.statusMu.Lock()
+	if cfg.rejectedMd5 == contentMd5 && cfg.rejected != nil {
+		err = cfg.rejected.Err
+		cfg.statusMu.Unlock()
+		return err
+	}
+	ev := RejectEvent{
+		Source:  cfg.asyncKey,
+		Content: []byte(redactContent(content, cfg.contentType)),
+		Err:     err,
+		Time:    _now(),
+	}
+	cfg.rejected = &ev
+	cfg.rejectedMd5 = contentMd5
+	cfg.statusMu.Unlock()
+
+	// 自定义校验的错误中可能有已解密的值
+	logger.Errorf("reject async config[%s] content:%s", cfg.asyncKey, Redact(RootKey, err.Error()))
+	emitReject(ev)
+
+	return err
+}
+
+func (cfg *asyncConfig) clearRejected() {
+	cfg.statusMu.Lock()
+	defer cfg.statusMu.Unlock()
+
+	cfg.rejectedMd5 = ""
+}
+
+// AddValidator 添加配置校验，之后刷新的内容需通过校验才会生效
+func (c *AsyncConfig) AddValidator(v Validator) {
+	c.Configer.(*asyncConfig).addValidator(v)
+}
+
+// Rejected 返回最近一次被拒绝的内容，没有时返回nil
+func (c *AsyncConfig) Rejected() *RejectEvent {
+	cfg := c.Configer.(*asyncConfig)
+	cfg.statusMu.RLock()
+	defer cfg.statusMu.RUnlock()
+
+	return cfg.rejected
+}
+
+func (m *mapConfig) addValidator(v Validator) {
+	m.validatorsMu.Lock()
+	defer m.validatorsMu.Unlock()
+
+	m.validators = append(m.validators[:len(m.validators):len(m.validators)], v)
+}
+
+func (m *mapConfig) getValidators() []Validator {
+	m.validatorsMu.RLock()
+	defer m.validatorsMu.RUnlock()
+
+	return m.validators
+}
+
+// AddValidator 添加配置校验，之后的Set需通过校验才会生效
+func (c *MapConfig) AddValidator(v Validator) {
+	c.Configer.(*mapConfig).addValidator(v)
+}
+
+// Rejected 本地配置校验失败时Set直接返回错误，总是返回nil
+func (c *MapConfig) Rejected() *RejectEvent {
+	return nil
+}
+
+// AddValidator 为Layer添加配置校验，对之后添加（或Load）的同名Layer同样生效
+// 仅对支持校验的Layer（如AsyncConfig、MapConfig）生效
+// Layer已存在时立即校验其当前内容（如启动参数加载的配置文件），不通过时返回错误，当前内容继续生效
+func (cfg *defaultConfig) AddValidator(layerName string, v Validator) error {
+	cfg.validatorsMu.Lock()
+	if cfg.validators == nil {
+		cfg.validators = make(map[string][]Validator)
+	}
+	cfg.validators[layerName] = append(cfg.validators[layerName], v)
+	cfg.validatorsMu.Unlock()
+
+	layer, ok := cfg.layers.Load(layerName)
+	if !ok {
+		return nil
+	}
+	adder, ok := layer.(validatorAdder)
+	if !ok {
+		logger.Warnf("layer[%s] does not support validator", layerName)
+		return nil
+	}
+	adder.AddValidator(v)
+
+	// 尚未加载成功的配置在加载时校验
+	if tree := layer.(Configer).Get(RootKey); tree != nil {
+		if err := v(tree, nil); err != nil {
+			return errors.Wrapf(err, "validate layer[%s]", layerName)
+		}
+	}
+
+	return nil
+}
+
+func AddValidator(layerName string, v Validator) error {
+	return _cfg.AddValidator(layerName, v)
+}
+
+// applyValidators 为新添加的Layer添加已注册的校验，并校验其当前内容
+func (cfg *defaultConfig) applyValidators(layerName string, layer Configer) error {
+	adder, ok := layer.(validatorAdder)
+	if !ok {
+		return nil
+	}
+
+	validators := cfg.layerValidators(layerName)
+	for _, v := range validators {
+		adder.AddValidator(v)
+	}
+
+	// 尚未加载成功的配置在加载时校验
+	tree := layer.Get(RootKey)
+	if tree == nil {
+		return nil
+	}
+	for _, v := range validators {
+		if err := v(tree, nil); err != nil {
+			return errors.Wrapf(err, "validate layer[%s]", layerName)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *defaultConfig) layerValidators(layerName string) []Validator {
+	cfg.validatorsMu.Lock()
+	defer cfg.validatorsMu.Unlock()
+
+	return cfg.validators[layerName]
+}
+
+// Rejected 返回Layer最近一次被拒绝的内容，没有时返回nil
+func (cfg *defaultConfig) Rejected(layerName string) *RejectEvent {
+	if layer, ok := cfg.layers.Load(layerName); ok {
+		if adder, ok := layer.(validatorAdder); ok {
+			return adder.Rejected()
+		}
+	}
+
+	return nil
+}
+
+func Rejected(layerName string) *RejectEvent {
+	return _cfg.Rejected(layerName)
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	ast := assert.New(t)
+
+	key := "validate_key"
+	layerName := "validate_layer"
+	remote := &slowAsyncer{data: map[string][]byte{
+		key: []byte(`{"port":80}`),
+	}}
+
+	AddValidator(layerName, func(newTree, oldTree interface{}) error {
+		m, _ := newTree.(map[string]interface{})
+		if port, ok := m["port"].(int64); !ok || port <= 0 {
+			return errors.New("invalid port")
+		}
+		return nil
+	})
+
+	var events []RejectEvent
+	sub := OnReject(func(ev RejectEvent) {
+		events = append(events, ev)
+	})
+	defer sub.Cancel()
+
+	cfg := NewAsyncConfig(remote, key, time.Millisecond, false)
+	AddLayer(layerName, cfg)
+	defer RemoveLayer(layerName)
+	ast.EqualValues(80, Int("port", layerName))
+
+	// bad push is rejected, previous value kept
+	remote.Set(key, []byte(`{"port":-1}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(80, Int("port", layerName))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(80, Int("port", layerName))
+	ast.Len(events, 1, "same content rejected once")
+	ast.Equal(key, events[0].Source)
+
+	rejected := Rejected(layerName)
+	ast.NotNil(rejected)
+	ast.Equal(`{"port":-1}`, string(rejected.Content))
+	ast.Contains(rejected.Err.Error(), "invalid port")
+
+	status := cfg.Status()
+	ast.True(status.Rejected)
+	ast.NotNil(status.LastError)
+
+	// local Set is validated too
+	ast.NotNil(cfg.Set("port", int64(0)))
+	ast.EqualValues(80, cfg.Int("port"))
+
+	// valid push
+	remote.Set(key, []byte(`{"port":8080}`))
+	time.Sleep(2 * time.Millisecond)
+	ast.EqualValues(8080, Int("port", layerName))
+	ast.False(cfg.Status().Rejected)
+	ast.NotNil(cfg.Rejected(), "last rejected content kept for debugging")
+}
+
+func TestMapConfigValidator(t *testing.T) {
+	ast := assert.New(t)
+
+	schema, err := ParseSchema([]byte(`{"type":"object","properties":{"port":{"type":"integer","minimum":1}}}`), T_JSON)
+	ast.Nil(err)
+
+	cfg := newConfig()
+	layer := NewMapConfig(map[string]interface{}{"db": map[string]interface{}{"port": int64(80)}})
+	cfg.AddLayer(DefaultLayerName, layer)
+	ast.Nil(cfg.AddSchema(DefaultLayerName, "db", schema))
+
+	// Set is validated, previous value kept
+	err = cfg.Set2("db.port", 0)
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "path[db.port] value 0 less than minimum 1")
+	ast.EqualValues(80, cfg.Int("db.port"))
+	ast.Nil(cfg.Set2("db.port", 8080))
+	ast.EqualValues(8080, cfg.Int("db.port"))
+
+	// loaded content is validated on registration
+	ast.Nil(layer.Set("cache.port", -1))
+	err = cfg.AddSchema(DefaultLayerName, "cache", schema)
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "path[cache.port] value -1 less than minimum 1")
+	ast.EqualValues(-1, cfg.Int("cache.port"))
+
+	// layers added later get the registered validators, including the one that failed on registration
+	other := NewMapConfig(map[string]interface{}{
+		"db":    map[string]interface{}{"port": int64(1)},
+		"cache": map[string]interface{}{"port": int64(1)},
+	}, false)
+	ast.Nil(cfg.AddLayer(DefaultLayerName, other))
+	ast.NotNil(other.Set("db.port", 0))
+	ast.EqualValues(1, other.Int("db.port"))
+	ast.Nil(other.Set("db.port", 2))
+	ast.EqualValues(2, other.Int("db.port"))
+
+	// current content of the added layer is validated, invalid layers are not added
+	invalid := NewMapConfig(map[string]interface{}{
+		"db":    map[string]interface{}{"port": int64(0)},
+		"cache": map[string]interface{}{"port": int64(1)},
+	}, false)
+	err = cfg.AddLayer(DefaultLayerName, invalid)
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "validate layer[default]")
+	ast.Contains(err.Error(), "path[db.port] value 0 less than minimum 1")
+	ast.EqualValues(2, cfg.Int("db.port"))
+
+	// missing node is reported
+	err = cfg.AddLayer(DefaultLayerName, NewMapConfig(map[string]interface{}{
+		"db": map[string]interface{}{"port": int64(3)},
+	}, false))
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "path[cache] required")
+	ast.EqualValues(2, cfg.Int("db.port"))
+}
+
+func TestRejectTime(t *testing.T) {
+	ast := assert.New(t)
+
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	originFun := _now
+	_now = func() time.Time {
+		return tm
+	}
+	defer func() {
+		_now = originFun
+	}()
+
+	key := "reject_time_key"
+	remote := &slowAsyncer{data: map[string][]byte{key: []byte(`{"port":0}`)}}
+	cfg := NewAsyncConfig(remote, key, 0, false, WithValidator(func(newTree, _ interface{}) error {
+		return errors.New("invalid port")
+	}))
+	defer cfg.Close()
+
+	if ast.NotNil(cfg.Rejected()) {
+		ast.Equal(tm, cfg.Rejected().Time)
+	}
+	ast.Contains(cfg.Status().LastErrorMessage, "invalid port")
+}
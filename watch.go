@@ -0,0 +1,427 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/techxmind/go-utils/object"
+)
+
+// ChangeEvent 配置节点变更事件
+type ChangeEvent struct {
+	// 监听的节点
+	KeyPath string
+
+	// 变更前后节点的值，节点不存在时为nil
+	OldValue interface{}
+	NewValue interface{}
+
+	// 发生变更的Layer，直接监听单个配置对象时为空
+	Layer string
+
+	// 节点下实际发生变更的完整路径
+	ChangedPaths []string
+}
+
+// KeyWatcher 支持按节点监听配置变化
+type KeyWatcher interface {
+	// WatchKey 监听指定节点，仅当该节点（含子节点）的值发生变化时回调
+	// 回调按变更顺序同步执行（并发变更时可能在其它变更的goroutine中执行），不应阻塞
+	WatchKey(keyPath string, fn func(ev ChangeEvent)) Subscription
+}
+
+// Subscription 配置变更的订阅，Cancel后不再收到通知
+type Subscription interface {
+	Cancel()
+}
+
+type subscription struct {
+	once   sync.Once
+	cancel func()
+}
+
+func newSubscription(cancel func()) Subscription {
+	return &subscription{
+		cancel: cancel,
+	}
+}
+
+func (s *subscription) Cancel() {
+	s.once.Do(s.cancel)
+}
+
+// multiSubscription 多个订阅的组合
+type multiSubscription []Subscription
+
+func (s multiSubscription) Cancel() {
+	for _, sub := range s {
+		sub.Cancel()
+	}
+}
+
+// bindContext ctx结束时自动取消订阅
+func bindContext(ctx context.Context, sub Subscription) Subscription {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Cancel()
+		case <-done:
+		}
+	}()
+
+	return newSubscription(func() {
+		close(done)
+		sub.Cancel()
+	})
+}
+
+type keyWatcher struct {
+	keyPath   string
+	fn        func(ev ChangeEvent)
+	cancelled int32
+}
+
+type notifierEntry struct {
+	notifier chan struct{}
+}
+
+// watchers 管理配置对象的变更监听者
+// 监听者列表写时复制，通知时无需持有锁
+type watchers struct {
+	mu          sync.RWMutex
+	notifiers   []*notifierEntry
+	keyWatchers []*keyWatcher
+	closed      bool
+
+	// 待发送的通知，按写入顺序依次发送，见enqueue
+	queueMu     sync.Mutex
+	queue       []func()
+	dispatching bool
+}
+
+// nopSubscription 已关闭的配置对象返回的订阅
+type nopSubscription struct{}
+
+func (nopSubscription) Cancel() {}
+
+// close 移除所有监听者，之后的监听请求被忽略
+func (w *watchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, kw := range w.keyWatchers {
+		atomic.StoreInt32(&kw.cancelled, 1)
+	}
+	w.notifiers = nil
+	w.keyWatchers = nil
+	w.closed = true
+}
+
+func (w *watchers) addNotifier(notifier chan struct{}) Subscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nopSubscription{}
+	}
+
+	entry := &notifierEntry{notifier: notifier}
+	w.notifiers = append(w.notifiers[:len(w.notifiers):len(w.notifiers)], entry)
+
+	return newSubscription(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		notifiers := make([]*notifierEntry, 0, len(w.notifiers))
+		for _, item := range w.notifiers {
+			if item != entry {
+				notifiers = append(notifiers, item)
+			}
+		}
+		w.notifiers = notifiers
+	})
+}
+
+func (w *watchers) addKeyWatcher(keyPath string, fn func(ev ChangeEvent)) Subscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nopSubscription{}
+	}
+
+	kw := &keyWatcher{
+		keyPath: keyPath,
+		fn:      fn,
+	}
+	w.keyWatchers = append(w.keyWatchers[:len(w.keyWatchers):len(w.keyWatchers)], kw)
+
+	return newSubscription(func() {
+		atomic.StoreInt32(&kw.cancelled, 1)
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		kws := make([]*keyWatcher, 0, len(w.keyWatchers))
+		for _, item := range w.keyWatchers {
+			if item != kw {
+				kws = append(kws, item)
+			}
+		}
+		w.keyWatchers = kws
+	})
+}
+
+// changeRoots 返回设置keyPath时需要对比的子树：keyPath及被监听的最浅的父节点，没有节点监听者时返回nil
+// keyPath为RootKey时（合并value），按value的每个顶层节点分别计算
+func (w *watchers) changeRoots(keyPath string, value interface{}) []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if len(w.keyWatchers) == 0 {
+		return nil
+	}
+
+	if keyPath != RootKey {
+		return []string{w.changeRoot(keyPath)}
+	}
+
+	vm, _ := value.(map[string]interface{})
+	roots := make([]string, 0, len(vm))
+	for k := range vm {
+		root := w.changeRoot(k)
+		if root == RootKey {
+			return []string{RootKey}
+		}
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	return roots
+}
+
+func (w *watchers) changeRoot(keyPath string) string {
+	root := keyPath
+	for _, kw := range w.keyWatchers {
+		if kw.keyPath == RootKey {
+			return RootKey
+		}
+		if len(kw.keyPath) < len(root) && strings.HasPrefix(keyPath, kw.keyPath+".") {
+			root = kw.keyPath
+		}
+	}
+
+	return root
+}
+
+// enqueue 登记一次变更的通知，应在持有配置写锁时调用，之后调用dispatch发送
+// 并发写入时通知按登记顺序发送；回调中再次写入配置时，其通知在当前回调返回后发送
+func (w *watchers) enqueue(fn func()) {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	w.queue = append(w.queue, fn)
+}
+
+// dispatch 依次发送已登记的通知，已有goroutine在发送时直接返回（由其发送）
+func (w *watchers) dispatch() {
+	w.queueMu.Lock()
+	if w.dispatching {
+		w.queueMu.Unlock()
+		return
+	}
+	w.dispatching = true
+
+	for len(w.queue) > 0 {
+		fn := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.queueMu.Unlock()
+		fn()
+		w.queueMu.Lock()
+	}
+
+	w.dispatching = false
+	w.queueMu.Unlock()
+}
+
+// notify 通知所有监听者配置发生了变化
+func (w *watchers) notify() {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, entry := range w.notifiers {
+		select {
+		case entry.notifier <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyChanges 对比新旧配置树，回调关注节点发生了变化的监听者
+func (w *watchers) notifyChanges(oldTree, newTree interface{}) {
+	w.notifyChangesAt(RootKey, oldTree, newTree)
+}
+
+// notifyChangesAt 同notifyChanges，只对比root节点的子树，oldSub/newSub为root节点变更前后的值
+func (w *watchers) notifyChangesAt(root string, oldSub, newSub interface{}) {
+	w.mu.RLock()
+	kws := w.keyWatchers
+	w.mu.RUnlock()
+
+	if len(kws) == 0 {
+		return
+	}
+
+	changed := diffTree(root, oldSub, newSub)
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, kw := range kws {
+		if atomic.LoadInt32(&kw.cancelled) == 1 {
+			continue
+		}
+		rel, ok := relativeKeyPath(root, kw.keyPath)
+		if !ok {
+			// 监听root的父节点（变更后才添加的监听者）或无关节点
+			continue
+		}
+		paths := filterChangedPaths(changed, kw.keyPath)
+		if len(paths) == 0 {
+			continue
+		}
+		oldValue := subtree(oldSub, rel)
+		newValue := subtree(newSub, rel)
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		kw.fn(ChangeEvent{
+			KeyPath:      kw.keyPath,
+			OldValue:     oldValue,
+			NewValue:     newValue,
+			ChangedPaths: paths,
+		})
+	}
+}
+
+func watchKey(c Configer, keyPath string, fn func(ev ChangeEvent)) Subscription {
+	if w, ok := c.(KeyWatcher); ok {
+		return w.WatchKey(keyPath, fn)
+	}
+
+	return watchKeyByNotifier(c, keyPath, fn)
+}
+
+// watchKeyByNotifier 为不支持KeyWatcher的配置对象，基于Watch实现节点监听
+func watchKeyByNotifier(c Configer, keyPath string, fn func(ev ChangeEvent)) Subscription {
+	notifier := make(chan struct{}, 1)
+	done := make(chan struct{})
+	oldValue := deepcopy.Copy(c.Get(keyPath))
+	sub := c.Watch(notifier)
+
+	go func() {
+		for {
+			select {
+			case <-notifier:
+			case <-done:
+				return
+			}
+			newValue := c.Get(keyPath)
+			if paths := diffTree(keyPath, oldValue, newValue); len(paths) > 0 {
+				fn(ChangeEvent{
+					KeyPath:      keyPath,
+					OldValue:     oldValue,
+					NewValue:     newValue,
+					ChangedPaths: paths,
+				})
+			}
+			oldValue = deepcopy.Copy(newValue)
+		}
+	}()
+
+	return newSubscription(func() {
+		sub.Cancel()
+		close(done)
+	})
+}
+
+// relativeKeyPath 返回keyPath相对于root的路径，keyPath不是root或其子节点时返回false
+func relativeKeyPath(root, keyPath string) (string, bool) {
+	switch {
+	case root == RootKey:
+		return keyPath, true
+	case keyPath == root:
+		return RootKey, true
+	case strings.HasPrefix(keyPath, root+"."):
+		return keyPath[len(root)+1:], true
+	}
+
+	return "", false
+}
+
+// subtree 返回tree中keyPath节点的值，不存在时返回nil
+func subtree(tree interface{}, keyPath string) interface{} {
+	if keyPath == RootKey {
+		return tree
+	}
+
+	val, _ := object.GetValue(tree, keyPath)
+	return val
+}
+
+func joinKeyPath(prefix string, key string) string {
+	if prefix == RootKey {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// diffTree 返回新旧配置树中值不同的节点路径
+// map会逐层对比，其它类型（包括数组）作为整体对比
+func diffTree(prefix string, oldTree, newTree interface{}) []string {
+	oldMap, oldOk := oldTree.(map[string]interface{})
+	newMap, newOk := newTree.(map[string]interface{})
+
+	if !oldOk || !newOk {
+		if reflect.DeepEqual(oldTree, newTree) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for k, ov := range oldMap {
+		changed = append(changed, diffTree(joinKeyPath(prefix, k), ov, newMap[k])...)
+	}
+	for k, nv := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			changed = append(changed, diffTree(joinKeyPath(prefix, k), nil, nv)...)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// filterChangedPaths 返回与keyPath相关（keyPath自身、子节点或父节点）的变更路径
+func filterChangedPaths(changed []string, keyPath string) []string {
+	if keyPath == RootKey {
+		return changed
+	}
+
+	var paths []string
+	for _, p := range changed {
+		if p == RootKey || p == keyPath || strings.HasPrefix(p, keyPath+".") || strings.HasPrefix(keyPath, p+".") {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTree(t *testing.T) {
+	ast := assert.New(t)
+
+	oldTree := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": 1,
+			"c": []interface{}{1, 2},
+		},
+		"d": "d",
+	}
+	newTree := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": 2,
+			"c": []interface{}{1, 2},
+		},
+		"e": "e",
+	}
+
+	ast.Equal([]string{"a.b", "d", "e"}, diffTree(RootKey, oldTree, newTree))
+	ast.Nil(diffTree(RootKey, oldTree, oldTree))
+	ast.Equal([]string{"a.b"}, filterChangedPaths([]string{"a.b", "d"}, "a"))
+	ast.Equal([]string{"a"}, filterChangedPaths([]string{"a"}, "a.b"))
+}
+
+func TestMapConfigWatchKey(t *testing.T) {
+	ast := assert.New(t)
+
+	for _, syncMode := range []bool{true, false} {
+		cfg := NewMapConfig(getTestConfigMap(), syncMode)
+
+		var events []ChangeEvent
+		cfg.WatchKey("l1.l11", func(ev ChangeEvent) {
+			events = append(events, ev)
+		})
+
+		cfg.Set("l2", 1)
+		ast.Len(events, 0)
+
+		cfg.Set("l1.l11.l112", "l112_value")
+		ast.Len(events, 0)
+
+		cfg.Set("l1.l11.l112", "changed")
+		if ast.Len(events, 1) {
+			ev := events[0]
+			ast.Equal("l1.l11", ev.KeyPath)
+			ast.Equal("l112_value", ev.OldValue.(map[string]interface{})["l112"])
+			ast.Equal("changed", ev.NewValue.(map[string]interface{})["l112"])
+			ast.Equal([]string{"l1.l11.l112"}, ev.ChangedPaths)
+		}
+	}
+}
+
+func TestMapConfigWatchKeySubtree(t *testing.T) {
+	ast := assert.New(t)
+
+	for _, syncMode := range []bool{true, false} {
+		cfg := NewMapConfig(getTestConfigMap(), syncMode)
+
+		var events []ChangeEvent
+		cfg.WatchKey("l1", func(ev ChangeEvent) {
+			events = append(events, ev)
+		})
+		cfg.WatchKey("l1.l11.l112", func(ev ChangeEvent) {
+			events = append(events, ev)
+		})
+
+		// only the watched ancestor is compared
+		ast.Equal([]string{"l1"}, cfg.Configer.(*mapConfig).watchers.changeRoots("l1.l11.l112", "x"))
+		ast.Equal([]string{"l2", "l3"}, cfg.Configer.(*mapConfig).watchers.changeRoots(RootKey, map[string]interface{}{"l3": 1, "l2": 1}))
+
+		cfg.Set("l1.l11.l112", "changed")
+		if ast.Len(events, 2) {
+			ast.Equal("l1", events[0].KeyPath)
+			ast.Equal("l112_value", events[0].OldValue.(map[string]interface{})["l11"].(map[string]interface{})["l112"])
+			ast.Equal("changed", events[1].NewValue)
+			ast.Equal("l112_value", events[1].OldValue)
+		}
+
+		events = nil
+		cfg.Set(RootKey, map[string]interface{}{"l1": map[string]interface{}{"l12": 1}, "l2": 2})
+		if ast.Len(events, 1) {
+			ast.Equal([]string{"l1.l12"}, events[0].ChangedPaths)
+		}
+	}
+}
+
+func TestMapConfigWatchKeyOrder(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := NewMapConfig(nil)
+	var (
+		last   interface{}
+		broken bool
+		count  int
+	)
+	cfg.WatchKey("n", func(ev ChangeEvent) {
+		// each event continues from the previous one
+		if ev.OldValue != last {
+			broken = true
+		}
+		last = ev.NewValue
+		count++
+		// nested Set is delivered after this callback returns
+		if ev.NewValue == 1 {
+			cfg.Set("nested", 1)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cfg.Set("n", i)
+		}(i)
+	}
+	wg.Wait()
+
+	ast.False(broken)
+	ast.Equal(50, count)
+	ast.Equal(1, cfg.Get("nested"))
+}
+
+func TestAsyncConfigWatchKey(t *testing.T) {
+	ast := assert.New(t)
+
+	asyncer := NewMockAsyncer(true)
+	asyncKey := "watch_key"
+	asyncer.Set(asyncKey, []byte(`{"a":{"b":1},"c":1}`))
+	cfg := NewAsyncConfig(asyncer, asyncKey, 0, false)
+
+	events := make(chan ChangeEvent, 10)
+	cfg.WatchKey("a", func(ev ChangeEvent) {
+		events <- ev
+	})
+
+	// only "c" and the mock counter changed
+	asyncer.Set(asyncKey, []byte(`{"a":{"b":1},"c":2}`))
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event:%v", ev)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	asyncer.Set(asyncKey, []byte(`{"a":{"b":2},"c":2}`))
+	select {
+	case ev := <-events:
+		ast.Equal([]string{"a.b"}, ev.ChangedPaths)
+		ast.EqualValues(2, ev.NewValue.(map[string]interface{})["b"])
+	case <-time.After(time.Second):
+		t.Fatal("wait event timeout")
+	}
+}
+
+func TestConfigWatchKey(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	cfg.AddLayer(DefaultLayerName, NewMapConfig(nil))
+	cfg.AddLayer("custom", NewMapConfig(nil))
+
+	var events []ChangeEvent
+	cfg.Layer("custom", DefaultLayerName).WatchKey("db", func(ev ChangeEvent) {
+		events = append(events, ev)
+	})
+
+	cfg.Set("db.host", "example.com")
+	cfg.Layer("custom").Set("db.port", 3306)
+	if ast.Len(events, 2) {
+		ast.Equal(DefaultLayerName, events[0].Layer)
+		ast.Equal("custom", events[1].Layer)
+		ast.Nil(events[1].OldValue)
+	}
+}
+
+func TestWatchSubscription(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := NewMapConfig(nil)
+	notifier := make(chan struct{}, 1)
+	sub := cfg.Watch(notifier)
+
+	cfg.Set("a", 1)
+	ast.Len(notifier, 1)
+	<-notifier
+
+	sub.Cancel()
+	sub.Cancel()
+	cfg.Set("a", 2)
+	ast.Len(notifier, 0)
+
+	var events int
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg.WatchKeyContext(ctx, "a", func(ev ChangeEvent) {
+		events++
+	})
+	cfg.Set("a", 3)
+	ast.Equal(1, events)
+	cancel()
+	time.Sleep(time.Millisecond)
+	cfg.Set("a", 4)
+	ast.Equal(1, events)
+}
+
+func TestWatchDefaultLayers(t *testing.T) {
+	ast := assert.New(t)
+
+	cfg := newConfig()
+	cfg.AddLayer(DefaultLayerName, NewMapConfig(nil))
+
+	notifier := make(chan struct{}, 1)
+	sub := cfg.Watch(notifier)
+
+	// layer added later is watched by existing default-layer subscriptions
+	layer := NewMapConfig(nil)
+	cfg.AddLayer("later", layer)
+	layer.Set("a", 1)
+	ast.Len(notifier, 0)
+
+	cfg.AddDefaultLayerName("later")
+	layer.Set("a", 2)
+	ast.Len(notifier, 1)
+	<-notifier
+
+	cfg.RemoveLayer("later")
+	layer.Set("a", 3)
+	ast.Len(notifier, 0)
+
+	sub.Cancel()
+	cfg.Set("a", 1)
+	ast.Len(notifier, 0)
+	ast.Len(cfg.defaultSubs, 0)
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretResolver 解析YAML中!secret标签引用的密钥，如从Vault、KMS获取
+type SecretResolver func(name string) (string, error)
+
+var (
+	_secretResolverMu sync.RWMutex
+	_secretResolver   SecretResolver
+
+	// yamlTags 自定义YAML标签，标签的值解析为字符串
+	yamlTags = map[string]func(value string) (string, error){
+		"!env":    resolveYAMLEnv,
+		"!file":   resolveYAMLFile,
+		"!base64": resolveYAMLBase64,
+		"!secret": resolveYAMLSecret,
+	}
+
+	// localYAMLTags 读取本机环境变量、文件的标签，只在本地配置中解析，见WithLocalTags
+	localYAMLTags = map[string]bool{
+		"!env":  true,
+		"!file": true,
+	}
+)
+
+// yamlTagOptions 解析YAML自定义标签的选项
+type yamlTagOptions struct {
+	// local 是否解析!env、!file，为false时包含这些标签的配置加载失败
+	local bool
+
+	// raw 不解析标签，保留标签的原始值，用于日志等不应读取外部数据的场景
+	raw bool
+
+	// secrets !secret解析得到的值
+	secrets []string
+
+	// tagged 是否有自定义标签（不含!include）
+	tagged bool
+}
+
+// SetSecretResolver 设置YAML中!secret标签的解析函数，未设置时包含!secret的配置加载失败
+//
+// YAMLMarshaler支持的自定义标签：
+//
+//	password: !env DB_PASS              # 环境变量，不存在时加载失败
+//	cert: !file /run/secrets/cert       # 文件内容，去掉末尾的换行
+//	token: !base64 aGVsbG8=             # base64解码
+//	api_key: !secret payment/api_key    # 由SecretResolver解析
+//
+// !env、!file只在本地配置文件中解析（见WithLocalTags），远程配置中使用时加载失败；
+// 使用了标签的异步配置不支持Set（返回ErrComposedConfig）。
+// 解析失败时，配置加载失败并返回YAMLTagError（包含标签所在的行、列）
+func SetSecretResolver(r SecretResolver) {
+	_secretResolverMu.Lock()
+	defer _secretResolverMu.Unlock()
+	_secretResolver = r
+}
+
+// YAMLTagError YAML自定义标签解析失败
+type YAMLTagError struct {
+	Line   int
+	Column int
+	Tag    string
+	Value  string
+	Err    error
+}
+
+func (e *YAMLTagError) Error() string {
+	return fmt.Sprintf("yaml: line %d column %d: %s %q: %v", e.Line, e.Column, e.Tag, e.Value, e.Err)
+}
+
+func (e *YAMLTagError) Unwrap() error {
+	return e.Err
+}
+
+// resolveYAMLTags 解析节点树中的自定义标签
+func resolveYAMLTags(node *yaml.Node, opts *yamlTagOptions) error {
+	if node.Tag == yamlIncludeTag {
+		convertYAMLInclude(node)
+	} else if resolve, ok := yamlTags[node.Tag]; ok {
+		tagErr := &YAMLTagError{
+			Line:   node.Line,
+			Column: node.Column,
+			Tag:    node.Tag,
+			Value:  node.Value,
+		}
+		if node.Kind != yaml.ScalarNode {
+			tagErr.Err = errors.New("value must be a scalar")
+			return tagErr
+		}
+		opts.tagged = true
+		value := node.Value
+		switch {
+		case opts.raw:
+		case localYAMLTags[node.Tag] && !opts.local:
+			tagErr.Err = errors.New("only allowed in local config")
+			return tagErr
+		default:
+			resolved, err := resolve(node.Value)
+			if err != nil {
+				tagErr.Err = err
+				return tagErr
+			}
+			if node.Tag == "!secret" {
+				opts.secrets = append(opts.secrets, resolved)
+			}
+			value = resolved
+		}
+		node.Tag = "!!str"
+		node.Style &^= yaml.TaggedStyle
+		node.Value = value
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := resolveYAMLTags(child, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolveYAMLEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.Errorf("env[%s] not set", name)
+	}
+
+	return value, nil
+}
+
+func resolveYAMLFile(file string) (string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func resolveYAMLBase64(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func resolveYAMLSecret(name string) (string, error) {
+	_secretResolverMu.RLock()
+	r := _secretResolver
+	_secretResolverMu.RUnlock()
+
+	if r == nil {
+		return "", errors.New("secret resolver not set")
+	}
+
+	return r(name)
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAMLTags(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	ast.Nil(err)
+	defer os.RemoveAll(tmpdir)
+	secretFile := filepath.Join(tmpdir, "cert")
+	ast.Nil(ioutil.WriteFile(secretFile, []byte("CERT\n"), 0600))
+
+	os.Setenv("YAML_TAG_TEST_PASS", "p@ss")
+	defer os.Unsetenv("YAML_TAG_TEST_PASS")
+
+	SetSecretResolver(func(name string) (string, error) {
+		if name == "api_key" {
+			return "k-123", nil
+		}
+		return "", errors.New("no such secret")
+	})
+	defer SetSecretResolver(nil)
+
+	var v interface{}
+	ast.Nil(YAMLMarshaler{}.Unmarshal([]byte(`
+db:
+  password: !env YAML_TAG_TEST_PASS
+  cert: !file `+secretFile+`
+token: !base64 aGVsbG8=
+api_key: !secret api_key
+plain: "!env NOT_A_TAG"
+`), &v))
+	m := NewMapConfig(v.(map[string]interface{}))
+	ast.Equal("p@ss", m.String("db.password"))
+	ast.Equal("CERT", m.String("db.cert"))
+	ast.Equal("hello", m.String("token"))
+	ast.Equal("k-123", m.String("api_key"))
+	ast.Equal("!env NOT_A_TAG", m.String("plain"))
+
+	tests := []struct {
+		content string
+		line    int
+		column  int
+		tag     string
+	}{
+		{"a: 1\nb: !env YAML_TAG_TEST_MISSING\n", 2, 4, "!env"},
+		{"a:\n  - !file /no/such/file\n", 2, 5, "!file"},
+		{"a: !base64 '***'\n", 1, 4, "!base64"},
+		{"a: !secret other\n", 1, 4, "!secret"},
+		{"a: !env [X]\n", 1, 4, "!env"},
+	}
+	for _, test := range tests {
+		err := YAMLMarshaler{}.Unmarshal([]byte(test.content), &v)
+		var tagErr *YAMLTagError
+		if ast.True(errors.As(err, &tagErr), "%q: %v", test.content, err) {
+			ast.Equal(test.line, tagErr.Line, test.content)
+			ast.Equal(test.column, tagErr.Column, test.content)
+			ast.Equal(test.tag, tagErr.Tag, test.content)
+		}
+	}
+
+	SetSecretResolver(nil)
+	ast.Error(YAMLMarshaler{}.Unmarshal([]byte("a: !secret api_key\n"), &v))
+}
+
+// yamlAsyncer 内容为YAML的slowAsyncer
+type yamlAsyncer struct {
+	*slowAsyncer
+}
+
+func (a yamlAsyncer) ContentType(key string) ContentType {
+	return T_YAML
+}
+
+func TestYAMLTagsRemote(t *testing.T) {
+	ast := assert.New(t)
+
+	os.Setenv("YAML_TAG_TEST_PASS", "p@ss")
+	defer os.Unsetenv("YAML_TAG_TEST_PASS")
+
+	resolved := 0
+	SetSecretResolver(func(name string) (string, error) {
+		resolved++
+		return "k-" + name, nil
+	})
+	defer SetSecretResolver(nil)
+
+	key := "yaml_tags_key"
+	remote := yamlAsyncer{&slowAsyncer{data: map[string][]byte{
+		key: []byte("password: !env YAML_TAG_TEST_PASS\n"),
+	}}}
+
+	// remote config can not read local env or files
+	cfg := NewAsyncConfig(remote, key, 0, false)
+	defer cfg.Close()
+	ast.Nil(cfg.Get("password"))
+	var tagErr *YAMLTagError
+	ast.True(errors.As(cfg.Status().LastError, &tagErr))
+
+	// wrapped local files are still local
+	tmpdir, err := ioutil.TempDir("", "")
+	ast.Nil(err)
+	defer os.RemoveAll(tmpdir)
+	file := filepath.Join(tmpdir, "tags.yml")
+	ast.Nil(ioutil.WriteFile(file, []byte("password: !env YAML_TAG_TEST_PASS\n"), 0600))
+	fileCfg := NewAsyncConfig(NewCachedAsyncer(NewResilientAsyncer(NewFileAsyncer(), nil), filepath.Join(tmpdir, "cache")), file, 0, false)
+	defer fileCfg.Close()
+	ast.Equal("p@ss", fileCfg.String("password"))
+
+	cfg2 := NewAsyncConfig(remote, key, 0, false, WithLocalTags(true))
+	defer cfg2.Close()
+	ast.Equal("p@ss", cfg2.String("password"))
+
+	// values of !secret are redacted
+	remote.Set(key, []byte("api_key: !secret api_key_1234\n"))
+	cfg3 := NewAsyncConfig(remote, key, 0, false)
+	defer cfg3.Close()
+	ast.Equal("k-api_key_1234", cfg3.String("api_key"))
+	ast.Equal("url?key=******", Redact(RootKey, "url?key=k-api_key_1234"))
+
+	// logging content does not resolve tags
+	resolved = 0
+	ast.Equal("api_key: api_key_1234\n", redactContent([]byte("api_key: !secret api_key_1234\n"), T_YAML))
+	ast.Equal("user: YAML_TAG_TEST_PASS\n", redactContent([]byte("user: !env YAML_TAG_TEST_PASS\n"), T_YAML))
+	ast.Equal(0, resolved)
+}